@@ -5,18 +5,27 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	// Embedded time zone data for the time-of-day conditions of redirect
+	// rules, as the runtime image ships without it
+	_ "time/tzdata"
 
 	"url-shortener/internal/config"
+	"url-shortener/internal/database"
+	"url-shortener/internal/geoip"
 	"url-shortener/internal/handler"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/repository"
 	"url-shortener/internal/service"
+	"url-shortener/internal/tracing"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -25,73 +34,189 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Log JSON records to stdout; the standard logger is routed through it too
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	slog.SetDefault(logging.New(os.Stdout, level))
+	if err != nil {
+		fatal("Invalid log configuration", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	// Administrative subcommands run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:]); err != nil {
+			fatal("Command failed", err)
+		}
+		return
+	}
+
+	// Trace requests through the service down to PostgreSQL and Redis
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, cfg.Tracing.ServiceName)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
 	// Initialize PostgreSQL
 	db, err := initPostgres(cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		fatal("Failed to connect to PostgreSQL", err)
 	}
 	defer func() {
 		if err := db.Close(); err != nil {
-			log.Printf("Error closing database connection: %v", err)
+			slog.Error("Error closing database connection", "error", err)
 		}
 	}()
 
 	// Run migrations
-	if err := runMigrations(db); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if err := runMigrations(context.Background(), db); err != nil {
+		fatal("Failed to run migrations", err)
+	}
+
+	// Initialize metrics, including the database connection pool stats
+	serverMetrics := metrics.New()
+	if err := serverMetrics.RegisterDB(db, cfg.Database.DBName); err != nil {
+		fatal("Failed to register database metrics", err)
 	}
 
 	// Initialize Redis
 	redisClient := initRedis(cfg.Redis)
 	defer func() {
 		if err := redisClient.Close(); err != nil {
-			log.Printf("Error closing Redis connection: %v", err)
+			slog.Error("Error closing Redis connection", "error", err)
 		}
 	}()
 
 	// Test Redis connection
 	ctx := context.Background()
 	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		fatal("Failed to connect to Redis", err)
 	}
 
 	// Initialize repositories
 	pgRepo := repository.NewPostgresRepository(db)
 	redisRepo := repository.NewRedisRepository(redisClient)
 
+	// Start click aggregation (flushed in batches, and once more on shutdown)
+	clickAggregator := service.NewClickAggregator(pgRepo, cfg.Clicks.FlushInterval, cfg.Clicks.BatchSize,
+		service.WithFlushMetrics(serverMetrics))
+	clickAggregator.Start()
+
 	// Initialize services
-	urlService := service.NewURLService(pgRepo, redisRepo, cfg.Server.BaseURL)
+	codeGenerator, err := service.NewCodeGenerator(cfg.Codes.Generator, pgRepo, cfg.Codes.MinLength, cfg.Codes.Key)
+	if err != nil {
+		fatal("Invalid short code configuration", err)
+	}
+
+	urlPolicy, err := newURLPolicy(cfg)
+	if err != nil {
+		fatal("Failed to load URL policy", err)
+	}
+	go reloadOnHangup(urlPolicy)
+
+	countries, closeCountries, err := newCountryLookup(cfg.GeoIP)
+	if err != nil {
+		fatal("Failed to load GeoIP data", err)
+	}
+	defer closeCountries()
+
+	urlService := service.NewURLService(
+		pgRepo,
+		redisRepo,
+		cfg.Server.BaseURL,
+		service.WithIPHashSalt(cfg.Analytics.IPHashSalt),
+		service.WithClickAggregator(clickAggregator),
+		service.WithMaxBatchSize(cfg.Batch.MaxItems),
+		service.WithCodeGenerator(codeGenerator),
+		service.WithURLPolicy(urlPolicy),
+		service.WithURLNormalizer(service.NewURLNormalizer(cfg.URLPolicy.StripParams...)),
+		service.WithUnlockTokens([]byte(cfg.Unlock.Secret), cfg.Unlock.TTL),
+		service.WithCountryLookup(countries),
+		service.WithMetrics(serverMetrics),
+	)
+	if cfg.Unlock.Secret == "" {
+		slog.Warn("UNLOCK_SECRET is not set; unlocked links only stay unlocked on this instance until it restarts")
+	}
+
+	authService := service.NewAuthService(pgRepo)
+
+	// Start the expired URL reaper (only one replica runs it at a time)
+	expiryReaper := service.NewExpiryReaper(pgRepo, redisRepo, cfg.Reaper.Interval, cfg.Reaper.BatchSize,
+		cfg.Reaper.Retention, service.WithReapMetrics(serverMetrics))
+	expiryReaper.Start()
 
 	// Initialize handlers
+	trustedProxies, err := handler.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		fatal("Invalid proxy configuration", err)
+	}
 	urlHandler := handler.NewURLHandler(urlService)
-
-	// Initialize rate limiter
-	rateLimiter := handler.NewRateLimiter(cfg.RateLimit.RequestsPerMinute)
+	authenticate := handler.AuthMiddleware(authService)
+
+	// Initialize rate limiters (password attempts are limited separately, per
+	// client and per link, so rotating addresses does not buy more guesses)
+	rateLimiter := handler.NewRateLimiter(cfg.RateLimit.RequestsPerMinute,
+		handler.WithRejectionMetrics(serverMetrics, "create"))
+	unlockLimiter := handler.NewRateLimiter(cfg.Unlock.RequestsPerMinute,
+		handler.WithRejectionMetrics(serverMetrics, "unlock"))
+	unlockLinkLimiter := handler.NewRateLimiter(cfg.Unlock.LinkRequestsPerMinute,
+		handler.WithRejectionMetrics(serverMetrics, "unlock_link"),
+		handler.WithRequestKey(handler.UnlockShortCode))
 
 	// Setup router
 	mux := http.NewServeMux()
 
-	// Health check endpoint
-	mux.HandleFunc("/health", urlHandler.HealthCheck)
-
-	// API endpoints
-	mux.HandleFunc("/api/v1/urls", urlHandler.CreateShortURL)
-	mux.HandleFunc("/api/v1/analytics/", urlHandler.GetAnalytics)
+	// Probes: readiness pings PostgreSQL and Redis, /health is kept as its alias
+	healthHandler := handler.NewHealthHandler(cfg.Server.HealthCheckTimeout,
+		handler.DependencyCheck{Name: "postgres", Ping: db.PingContext},
+		handler.DependencyCheck{Name: "redis", Ping: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}},
+	)
+	mux.HandleFunc("/livez", healthHandler.Live)
+	mux.HandleFunc("/readyz", healthHandler.Ready)
+	mux.HandleFunc("/health", healthHandler.Ready)
+
+	// API endpoints (rate limiting applies only to URL creation; everything
+	// except anonymous creation requires an API key)
+	var createHandler http.Handler = http.HandlerFunc(urlHandler.CreateShortURL)
+	if !cfg.Auth.AllowAnonymous {
+		createHandler = handler.RequireAuth(createHandler)
+	}
+	createHandler = handler.IdempotencyMiddleware(redisRepo, cfg.Idempotency.TTL)(createHandler)
+	mux.Handle("/api/v1/urls", authenticate(handler.MethodHandler{
+		http.MethodPost: handler.RateLimitMiddleware(rateLimiter)(createHandler),
+		http.MethodGet:  handler.RequireAuth(http.HandlerFunc(urlHandler.ListURLs)),
+	}))
+	mux.Handle("/api/v1/urls/batch", authenticate(handler.RequireAuth(handler.MethodHandler{
+		http.MethodPost: handler.RateLimitMiddleware(rateLimiter)(http.HandlerFunc(urlHandler.CreateShortURLBatch)),
+	})))
+	mux.Handle("/api/v1/urls/", authenticate(handler.RequireAuth(handler.MethodHandler{
+		http.MethodGet:    http.HandlerFunc(urlHandler.GetURL),
+		http.MethodPatch:  http.HandlerFunc(urlHandler.UpdateURL),
+		http.MethodDelete: http.HandlerFunc(urlHandler.DeleteURL),
+	})))
+	mux.Handle("/api/v1/unlock/", handler.MethodHandler{
+		http.MethodPost: handler.RateLimitMiddleware(unlockLimiter)(
+			handler.RateLimitMiddleware(unlockLinkLimiter)(http.HandlerFunc(urlHandler.UnlockURL)),
+		),
+	})
+	mux.Handle("/api/v1/analytics/", authenticate(handler.RequireAuth(http.HandlerFunc(urlHandler.GetAnalytics))))
 
 	// Redirect endpoint (catch-all for short codes)
 	mux.HandleFunc("/", urlHandler.RedirectToOriginal)
 
-	// Apply rate limiting only to the create URL endpoint
-	rateLimitedMux := http.NewServeMux()
-	rateLimitedMux.HandleFunc("/health", urlHandler.HealthCheck)
-	rateLimitedMux.Handle("/api/v1/urls", handler.RateLimitMiddleware(rateLimiter)(http.HandlerFunc(urlHandler.CreateShortURL)))
-	rateLimitedMux.HandleFunc("/api/v1/analytics/", urlHandler.GetAnalytics)
-	rateLimitedMux.HandleFunc("/", urlHandler.RedirectToOriginal)
-
 	// Apply global middleware
-	finalHandler := handler.CORSMiddleware(
-		handler.LoggingMiddleware(
-			handler.RecoveryMiddleware(rateLimitedMux),
+	finalHandler := handler.RequestIDMiddleware(
+		handler.CORSMiddleware(
+			handler.TracingMiddleware(handler.MuxRoute(mux))(
+				handler.LoggingMiddleware(serverMetrics, handler.MuxRoute(mux))(
+					handler.RecoveryMiddleware(
+						handler.ClientIPMiddleware(trustedProxies)(mux),
+					),
+				),
+			),
 		),
 	)
 
@@ -105,11 +230,28 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Start server in a goroutine
+	// Prometheus metrics are served on their own listener, so they are never
+	// reachable through the public port
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", serverMetrics.Handler())
+	metricsServer := &http.Server{
+		Addr:         cfg.Metrics.Addr,
+		Handler:      metricsMux,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+
+	// Start servers in goroutines
 	go func() {
-		log.Printf("Server starting on %s", addr)
+		slog.Info("Server starting", "addr", addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+			fatal("Server failed to start", err)
+		}
+	}()
+	go func() {
+		slog.Info("Metrics server starting", "addr", cfg.Metrics.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Metrics server failed to start", err)
 		}
 	}()
 
@@ -118,16 +260,42 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Server shutting down...")
+	slog.Info("Server shutting down")
+
+	// Fail readiness first and keep serving while load balancers notice
+	healthHandler.Drain()
+	time.Sleep(cfg.Server.ShutdownDrainDelay)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
+	}
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		slog.Error("Metrics server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server exited")
+	if err := expiryReaper.Stop(ctx); err != nil {
+		slog.Error("Expiry reaper did not stop cleanly", "error", err)
+	}
+
+	// Flush clicks buffered by requests that have now completed
+	if err := clickAggregator.Stop(ctx); err != nil {
+		slog.Error("Failed to flush pending clicks", "error", err)
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush pending spans", "error", err)
+	}
+
+	slog.Info("Server exited")
+}
+
+// fatal logs why the server cannot go on and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 // initPostgres initializes PostgreSQL connection
@@ -152,7 +320,7 @@ func initPostgres(cfg config.DatabaseConfig) (*sql.DB, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	log.Println("Connected to PostgreSQL")
+	slog.Info("Connected to PostgreSQL")
 	return db, nil
 }
 
@@ -164,40 +332,171 @@ func initRedis(cfg config.RedisConfig) *redis.Client {
 		DB:       cfg.DB,
 	})
 
-	log.Println("Connected to Redis")
+	slog.Info("Connected to Redis")
 	return client
 }
 
-// runMigrations runs database migrations
-func runMigrations(db *sql.DB) error {
-	migration := `
-		CREATE TABLE IF NOT EXISTS urls (
-			id BIGSERIAL PRIMARY KEY,
-			short_code VARCHAR(8) UNIQUE NOT NULL,
-			original_url TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			expires_at TIMESTAMP,
-			user_id UUID,
-			click_count BIGINT NOT NULL DEFAULT 0,
-			last_accessed TIMESTAMP
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_short_code ON urls(short_code);
-		CREATE INDEX IF NOT EXISTS idx_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
-	`
-
-	// Split by semicolon and execute each statement
-	statements := strings.Split(migration, ";")
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
+// newURLPolicy builds the destination URL policy from configuration
+func newURLPolicy(cfg *config.Config) (*service.URLPolicy, error) {
+	var opts []service.PolicyOption
+	if len(cfg.URLPolicy.AllowedSchemes) > 0 {
+		opts = append(opts, service.WithAllowedSchemes(cfg.URLPolicy.AllowedSchemes...))
+	}
+	if len(cfg.URLPolicy.ShortenerHosts) > 0 {
+		opts = append(opts, service.WithShortenerHosts(cfg.URLPolicy.ShortenerHosts...))
+	}
+	if cfg.URLPolicy.BlocklistFile != "" {
+		opts = append(opts, service.WithBlocklistFile(cfg.URLPolicy.BlocklistFile))
+	}
+	return service.NewURLPolicy(cfg.Server.BaseURL, opts...)
+}
+
+// newCountryLookup opens the MaxMind database configured for redirect rules'
+// country conditions or, without one, builds the configured stub. It returns
+// nil if neither is configured, and a function releasing the database.
+func newCountryLookup(cfg config.GeoIPConfig) (service.CountryLookup, func(), error) {
+	if cfg.DBPath != "" {
+		db, err := geoip.OpenMaxMindDB(cfg.DBPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.Info("Loaded GeoIP database", "path", cfg.DBPath)
+		return db, func() { _ = db.Close() }, nil
+	}
+	if len(cfg.Stub) > 0 {
+		stub, err := geoip.NewStub(cfg.Stub...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return stub, func() {}, nil
+	}
+	return nil, func() {}, nil
+}
+
+// reloadOnHangup reloads the URL blocklist whenever the process receives SIGHUP
+func reloadOnHangup(policy *service.URLPolicy) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		if err := policy.Reload(); err != nil {
+			slog.Error("Failed to reload URL blocklist", "error", err)
 			continue
 		}
-		if _, err := db.Exec(stmt); err != nil {
-			return fmt.Errorf("migration failed: %w", err)
+		slog.Info("Reloaded URL blocklist", "domains", policy.BlockedDomains())
+	}
+}
+
+// runMigrations applies all pending embedded migrations
+func runMigrations(ctx context.Context, db *sql.DB) error {
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range applied {
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+	}
+	slog.Info("Migrations completed successfully")
+	return nil
+}
+
+// commandUsage documents the administrative subcommands
+const commandUsage = `usage:
+  migrate up                       apply all pending migrations
+  migrate down [n]                 roll back the last n migrations (default 1)
+  migrate status                   list migrations and when they were applied
+  apikey create [user-id] [name]   issue an API key (a new user ID is generated if omitted)`
+
+// runCommand runs an administrative subcommand
+func runCommand(cfg *config.Config, args []string) error {
+	switch {
+	case args[0] == "migrate" && len(args) >= 2:
+		return migrate(cfg, args[1], args[2:])
+	case args[0] == "apikey" && len(args) >= 2 && args[1] == "create":
+		return createAPIKey(cfg, args[2:])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", strings.Join(args, " "), commandUsage)
+	}
+}
+
+// migrate runs the migrate up/down/status subcommands
+func migrate(cfg *config.Config, action string, args []string) error {
+	db, err := initPostgres(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		return runMigrations(ctx, db)
+
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[0])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, m := range rolledBack {
+			slog.Info("Rolled back migration", "version", m.Version, "name", m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%03d_%-30s %s\n", st.Version, st.Name, applied)
 		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%s", action, commandUsage)
+	}
+}
+
+// createAPIKey issues an API key and prints it once
+func createAPIKey(cfg *config.Config, args []string) error {
+	var userID, name string
+	if len(args) > 0 {
+		userID = args[0]
+	}
+	if len(args) > 1 {
+		name = strings.Join(args[1:], " ")
+	}
+
+	db, err := initPostgres(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	authService := service.NewAuthService(repository.NewPostgresRepository(db))
+	rawKey, key, err := authService.CreateAPIKey(context.Background(), userID, name)
+	if err != nil {
+		return err
 	}
 
-	log.Println("Migrations completed successfully")
+	fmt.Printf("user_id: %s\napi_key: %s\n", key.UserID, rawKey)
 	return nil
 }
@@ -2,16 +2,32 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all application configuration
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	Redis     RedisConfig
-	RateLimit RateLimitConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Redis       RedisConfig
+	RateLimit   RateLimitConfig
+	Analytics   AnalyticsConfig
+	Clicks      ClicksConfig
+	Auth        AuthConfig
+	Reaper      ReaperConfig
+	Batch       BatchConfig
+	Idempotency IdempotencyConfig
+	Codes       CodesConfig
+	URLPolicy   URLPolicyConfig
+	Unlock      UnlockConfig
+	GeoIP       GeoIPConfig
+	Log         LogConfig
+	Tracing     TracingConfig
+	Metrics     MetricsConfig
 }
 
 // ServerConfig holds server-related configuration
@@ -19,6 +35,14 @@ type ServerConfig struct {
 	Host    string
 	Port    string
 	BaseURL string
+	// HealthCheckTimeout bounds the dependency pings of a readiness probe
+	HealthCheckTimeout time.Duration
+	// ShutdownDrainDelay is how long the server keeps serving after readiness
+	// starts failing on shutdown, before it stops accepting connections
+	ShutdownDrainDelay time.Duration
+	// TrustedProxies are the IPs or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []string
 }
 
 // DatabaseConfig holds database connection configuration
@@ -44,13 +68,110 @@ type RateLimitConfig struct {
 	RequestsPerMinute int
 }
 
+// AnalyticsConfig holds click analytics configuration
+type AnalyticsConfig struct {
+	IPHashSalt string
+}
+
+// ClicksConfig holds click aggregation configuration
+type ClicksConfig struct {
+	FlushInterval time.Duration
+	BatchSize     int
+}
+
+// AuthConfig holds authentication configuration
+type AuthConfig struct {
+	AllowAnonymous bool
+}
+
+// ReaperConfig holds expired URL cleanup configuration
+type ReaperConfig struct {
+	Interval  time.Duration
+	BatchSize int
+	// Retention is how long expired URLs are kept (answering 410 and
+	// reporting analytics) before they are deleted
+	Retention time.Duration
+}
+
+// BatchConfig holds bulk link creation configuration
+type BatchConfig struct {
+	MaxItems int
+}
+
+// IdempotencyConfig holds Idempotency-Key handling configuration
+type IdempotencyConfig struct {
+	TTL time.Duration
+}
+
+// MaxCodeLength is the longest short code the urls.short_code column holds
+const MaxCodeLength = 20
+
+// CodesConfig holds short code generation configuration
+type CodesConfig struct {
+	Generator string
+	MinLength int
+	Key       string
+}
+
+// URLPolicyConfig holds the rules for which destination URLs may be shortened
+// and how they are canonicalized. Empty lists keep the built-in defaults.
+type URLPolicyConfig struct {
+	AllowedSchemes []string
+	ShortenerHosts []string
+	BlocklistFile  string
+	// StripParams are query parameters removed from canonical URLs
+	StripParams []string
+}
+
+// UnlockConfig holds the settings of password-protected links
+type UnlockConfig struct {
+	// Secret signs unlock cookies; it must be shared by all replicas
+	Secret            string
+	TTL               time.Duration
+	RequestsPerMinute int
+	// LinkRequestsPerMinute limits unlock attempts per link, across all clients
+	LinkRequestsPerMinute int
+}
+
+// GeoIPConfig holds the source of the country lookup used by redirect rules:
+// a MaxMind database file or, without one, a static stub
+type GeoIPConfig struct {
+	DBPath string
+	// Stub maps networks to countries, as "CIDR=CC" entries
+	Stub []string
+}
+
+// LogConfig holds logging configuration
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error
+	Level string
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	// Exporter is where spans are sent: otlp, stdout or none
+	Exporter string
+	// ServiceName is the service.name spans are reported under
+	ServiceName string
+}
+
+// MetricsConfig holds Prometheus metrics configuration
+type MetricsConfig struct {
+	// Addr is the address of the listener serving /metrics, kept apart from
+	// the public server
+	Addr string
+}
+
 // Load loads configuration from environment variables
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:    getEnv("SERVER_HOST", "0.0.0.0"),
-			Port:    getEnv("SERVER_PORT", "8080"),
-			BaseURL: getEnv("BASE_URL", "http://localhost:8080"),
+			Host:               getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:               getEnv("SERVER_PORT", "8080"),
+			BaseURL:            getEnv("BASE_URL", "http://localhost:8080"),
+			HealthCheckTimeout: getEnvAsDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+			ShutdownDrainDelay: getEnvAsDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+			TrustedProxies:     getEnvAsSlice("TRUSTED_PROXIES", nil),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "postgres"),
@@ -69,7 +190,68 @@ func Load() *Config {
 		RateLimit: RateLimitConfig{
 			RequestsPerMinute: getEnvAsInt("RATE_LIMIT_RPM", 10),
 		},
+		Analytics: AnalyticsConfig{
+			IPHashSalt: getEnv("ANALYTICS_IP_SALT", ""),
+		},
+		Clicks: ClicksConfig{
+			FlushInterval: getEnvAsDuration("CLICK_FLUSH_INTERVAL", 5*time.Second),
+			BatchSize:     getEnvAsInt("CLICK_FLUSH_BATCH_SIZE", 1000),
+		},
+		Auth: AuthConfig{
+			AllowAnonymous: getEnvAsBool("AUTH_ALLOW_ANONYMOUS", true),
+		},
+		Reaper: ReaperConfig{
+			Interval:  getEnvAsDuration("REAPER_INTERVAL", time.Hour),
+			BatchSize: getEnvAsInt("REAPER_BATCH_SIZE", 500),
+			Retention: getEnvAsDuration("REAPER_RETENTION", 30*24*time.Hour),
+		},
+		Batch: BatchConfig{
+			MaxItems: getEnvAsInt("BATCH_MAX_ITEMS", 1000),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		},
+		Codes: CodesConfig{
+			Generator: getEnv("CODE_GENERATOR", "sequential"),
+			MinLength: getEnvAsInt("CODE_MIN_LENGTH", 0),
+			Key:       getEnv("CODE_GENERATOR_KEY", ""),
+		},
+		URLPolicy: URLPolicyConfig{
+			AllowedSchemes: getEnvAsSlice("URL_ALLOWED_SCHEMES", nil),
+			ShortenerHosts: getEnvAsSlice("URL_SHORTENER_HOSTS", nil),
+			BlocklistFile:  getEnv("URL_BLOCKLIST_FILE", ""),
+			StripParams:    getEnvAsSlice("URL_STRIP_PARAMS", nil),
+		},
+		Unlock: UnlockConfig{
+			Secret:                getEnv("UNLOCK_SECRET", ""),
+			TTL:                   getEnvAsDuration("UNLOCK_TTL", 10*time.Minute),
+			RequestsPerMinute:     getEnvAsInt("UNLOCK_RATE_LIMIT_RPM", 5),
+			LinkRequestsPerMinute: getEnvAsInt("UNLOCK_LINK_RATE_LIMIT_RPM", 20),
+		},
+		GeoIP: GeoIPConfig{
+			DBPath: getEnv("GEOIP_DB_PATH", ""),
+			Stub:   getEnvAsSlice("GEOIP_STUB", nil),
+		},
+		Log: LogConfig{
+			Level: getEnv("LOG_LEVEL", "info"),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("TRACING_EXPORTER", "none"),
+			ServiceName: getEnv("TRACING_SERVICE_NAME", "url-shortener"),
+		},
+		Metrics: MetricsConfig{
+			Addr: getEnv("METRICS_ADDR", "0.0.0.0:9090"),
+		},
+	}
+}
+
+// Validate reports configuration values that would only fail once the server
+// is handling requests
+func (c *Config) Validate() error {
+	if c.Codes.MinLength < 0 || c.Codes.MinLength > MaxCodeLength {
+		return fmt.Errorf("CODE_MIN_LENGTH must be between 1 and %d (or 0 for the default), got %d", MaxCodeLength, c.Codes.MinLength)
 	}
+	return nil
 }
 
 // getEnv retrieves an environment variable or returns a default value
@@ -89,3 +271,39 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsBool retrieves an environment variable as a boolean or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice retrieves a comma-separated environment variable as a slice or returns a default value
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// getEnvAsDuration retrieves an environment variable as a duration (e.g. "5s") or returns a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -62,4 +63,62 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.RateLimit.RequestsPerMinute != 10 {
 		t.Errorf("Expected default rate limit 10, got %d", cfg.RateLimit.RequestsPerMinute)
 	}
+
+	if cfg.Clicks.FlushInterval != 5*time.Second {
+		t.Errorf("Expected default click flush interval 5s, got %s", cfg.Clicks.FlushInterval)
+	}
+
+	if !cfg.Auth.AllowAnonymous {
+		t.Error("Expected anonymous link creation to be allowed by default")
+	}
+
+	if cfg.Log.Level != "info" {
+		t.Errorf("Expected default log level 'info', got '%s'", cfg.Log.Level)
+	}
+
+	if cfg.Tracing.Exporter != "none" {
+		t.Errorf("Expected tracing to be off by default, got exporter '%s'", cfg.Tracing.Exporter)
+	}
+	if cfg.Server.ShutdownDrainDelay != 5*time.Second {
+		t.Errorf("Expected default shutdown drain delay 5s, got %s", cfg.Server.ShutdownDrainDelay)
+	}
+}
+
+func TestLoad_TypedValues(t *testing.T) {
+	_ = os.Setenv("CLICK_FLUSH_INTERVAL", "250ms")
+	_ = os.Setenv("AUTH_ALLOW_ANONYMOUS", "false")
+	defer func() {
+		_ = os.Unsetenv("CLICK_FLUSH_INTERVAL")
+		_ = os.Unsetenv("AUTH_ALLOW_ANONYMOUS")
+	}()
+
+	cfg := Load()
+
+	if cfg.Auth.AllowAnonymous {
+		t.Error("Expected anonymous link creation to be disabled")
+	}
+
+	if cfg.Clicks.FlushInterval != 250*time.Millisecond {
+		t.Errorf("Expected click flush interval 250ms, got %s", cfg.Clicks.FlushInterval)
+	}
+}
+
+func TestValidate_CodeMinLength(t *testing.T) {
+	tests := []struct {
+		minLength int
+		valid     bool
+	}{
+		{0, true},
+		{1, true},
+		{MaxCodeLength, true},
+		{MaxCodeLength + 1, false},
+		{-1, false},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Codes: CodesConfig{MinLength: tt.minLength}}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with CODE_MIN_LENGTH=%d returned %v, want valid=%v", tt.minLength, err, tt.valid)
+		}
+	}
 }
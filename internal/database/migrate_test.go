@@ -0,0 +1,78 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"010_tenth.up.sql":    {Data: []byte("CREATE TABLE c ();")},
+		"README.md":           {Data: []byte("ignored")},
+	}
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations returned error: %v", err)
+	}
+
+	wantVersions := []int64{1, 2, 10}
+	if len(migrations) != len(wantVersions) {
+		t.Fatalf("Expected %d migrations, got %d", len(wantVersions), len(migrations))
+	}
+	for i, version := range wantVersions {
+		if migrations[i].Version != version {
+			t.Errorf("Migration %d: expected version %d, got %d", i, version, migrations[i].Version)
+		}
+	}
+
+	if migrations[1].Name != "second" || migrations[1].Down != "DROP TABLE b;" {
+		t.Errorf("Unexpected migration: %+v", migrations[1])
+	}
+	if migrations[0].Down != "" {
+		t.Errorf("Expected no down migration for 001, got %q", migrations[0].Down)
+	}
+}
+
+func TestLoadMigrations_MissingUp(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_orphan.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Error("Expected error for migration without up file, got none")
+	}
+}
+
+func TestLoadMigrations_ConflictingNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_one.up.sql":   {Data: []byte("SELECT 1;")},
+		"001_other.up.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Error("Expected error for conflicting migration names, got none")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := NewMigrator(nil)
+	if err != nil {
+		t.Fatalf("NewMigrator returned error: %v", err)
+	}
+
+	if len(m.migrations) == 0 || m.migrations[0].Version != 1 || m.migrations[0].Name != "init" {
+		t.Fatalf("Expected embedded migrations to start with 001_init, got %+v", m.migrations)
+	}
+	for i, migration := range m.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("Expected contiguous versions, found %d at position %d", migration.Version, i)
+		}
+		if migration.Down == "" {
+			t.Errorf("Migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS delete_expired_urls();
+DROP TABLE IF EXISTS urls;
@@ -0,0 +1,12 @@
+-- Create click_events table recording every redirect
+CREATE TABLE IF NOT EXISTS click_events (
+    id BIGSERIAL PRIMARY KEY,
+    short_code VARCHAR(20) NOT NULL,
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_hash VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+-- Time-range lookups per short code
+CREATE INDEX IF NOT EXISTS idx_click_events_short_code_occurred_at ON click_events(short_code, occurred_at);
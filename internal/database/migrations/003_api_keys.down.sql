@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_urls_user_id;
+DROP TABLE IF EXISTS api_keys;
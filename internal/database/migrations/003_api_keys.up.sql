@@ -0,0 +1,14 @@
+-- Create api_keys table; keys are stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+-- Owner-scoped listings
+CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls(user_id, id) WHERE user_id IS NOT NULL;
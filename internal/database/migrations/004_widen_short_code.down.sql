@@ -0,0 +1,2 @@
+-- Narrowing short_code could truncate existing aliases, so this is intentionally a no-op
+SELECT 1;
@@ -0,0 +1,3 @@
+-- Databases bootstrapped by the old inline migration created short_code as
+-- VARCHAR(8); bring them in line with 001_init (a no-op everywhere else)
+ALTER TABLE urls ALTER COLUMN short_code TYPE VARCHAR(20);
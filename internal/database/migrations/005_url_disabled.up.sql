@@ -0,0 +1,2 @@
+-- Allow owners to switch a link off without deleting it
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
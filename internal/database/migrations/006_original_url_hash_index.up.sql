@@ -0,0 +1,2 @@
+-- Equality lookups of an owner's existing link for a long URL (reuse_existing)
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_hash ON urls USING HASH (original_url);
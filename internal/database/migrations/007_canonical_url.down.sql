@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_canonical_url_hash;
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_hash ON urls USING HASH (original_url);
+ALTER TABLE urls DROP COLUMN IF EXISTS canonical_url;
@@ -0,0 +1,8 @@
+-- Canonical form of the destination, used to deduplicate equivalent long URLs.
+-- Existing rows start out with their stored URL as canonical form.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS canonical_url TEXT;
+UPDATE urls SET canonical_url = original_url WHERE canonical_url IS NULL;
+ALTER TABLE urls ALTER COLUMN canonical_url SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_urls_original_url_hash;
+CREATE INDEX IF NOT EXISTS idx_urls_canonical_url_hash ON urls USING HASH (canonical_url);
@@ -0,0 +1,2 @@
+-- bcrypt hash of the password protecting a link (NULL for public links)
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash TEXT;
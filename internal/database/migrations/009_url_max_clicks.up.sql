@@ -0,0 +1,4 @@
+-- Click-limited links: redirects are counted in clicks_used as they happen,
+-- independently of the buffered click_count
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks BIGINT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks_used BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Links scheduled to start resolving at a later time
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS activates_at TIMESTAMP;
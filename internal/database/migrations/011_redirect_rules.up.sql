@@ -0,0 +1,10 @@
+-- Per-link redirect rules, evaluated in position order; the first rule whose
+-- conditions all match the visit decides the destination
+CREATE TABLE IF NOT EXISTS redirect_rules (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    target_url TEXT NOT NULL,
+    conditions JSONB NOT NULL DEFAULT '{}',
+    UNIQUE (url_id, position)
+);
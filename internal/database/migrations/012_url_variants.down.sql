@@ -0,0 +1,2 @@
+ALTER TABLE click_events DROP COLUMN IF EXISTS variant;
+ALTER TABLE urls DROP COLUMN IF EXISTS variants;
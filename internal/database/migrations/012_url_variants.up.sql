@@ -0,0 +1,5 @@
+-- Weighted A/B split destinations of a link
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB;
+
+-- The variant each click was sent to, for per-variant analytics
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
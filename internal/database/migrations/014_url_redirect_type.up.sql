@@ -0,0 +1,5 @@
+-- How visits are answered: a 301, 302, 307 or 308 redirect, or an interstitial page
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type TEXT NOT NULL DEFAULT '302';
+
+-- Shown on the interstitial and preview pages
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
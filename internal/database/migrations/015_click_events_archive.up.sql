@@ -0,0 +1,14 @@
+-- Click events of reaped links are moved here rather than deleted, so their
+-- history survives but is never attributed to a new link reusing the code
+CREATE TABLE IF NOT EXISTS click_events_archive (
+    id BIGINT PRIMARY KEY,
+    short_code VARCHAR(20) NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_hash VARCHAR(64) NOT NULL DEFAULT '',
+    variant TEXT NOT NULL DEFAULT '',
+    archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_archive_short_code ON click_events_archive(short_code, occurred_at);
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// APIKey represents an API key issued to a user. The raw key is only known at
+// creation time; only its hash is persisted.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
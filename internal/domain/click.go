@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxTimeSeriesBuckets bounds the number of buckets a single analytics query may return
+const MaxTimeSeriesBuckets = 2000
+
+// DefaultAnalyticsWindow is the time range used when an analytics query omits "from"
+const DefaultAnalyticsWindow = 7 * 24 * time.Hour
+
+// AnalyticsInterval is the bucket size of an analytics time series
+type AnalyticsInterval string
+
+// Supported analytics intervals
+const (
+	IntervalHour AnalyticsInterval = "hour"
+	IntervalDay  AnalyticsInterval = "day"
+	IntervalWeek AnalyticsInterval = "week"
+)
+
+// Valid reports whether the interval is supported
+func (i AnalyticsInterval) Valid() bool {
+	switch i {
+	case IntervalHour, IntervalDay, IntervalWeek:
+		return true
+	}
+	return false
+}
+
+// Truncate rounds t down to the start of its bucket in UTC.
+// Weeks start on Monday, matching PostgreSQL's date_trunc('week', ...).
+func (i AnalyticsInterval) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch i {
+	case IntervalHour:
+		return t.Truncate(time.Hour)
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Next returns the start of the bucket following the one starting at t
+func (i AnalyticsInterval) Next(t time.Time) time.Time {
+	switch i {
+	case IntervalHour:
+		return t.Add(time.Hour)
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// Visit describes the incoming request that resolved a short code
+type Visit struct {
+	Referrer  string
+	UserAgent string
+	ClientIP  string
+	// AcceptLanguage is the Accept-Language header, matched by redirect rules
+	AcceptLanguage string
+	// UnlockToken is the token issued when the visitor unlocked a
+	// password-protected link, if any
+	UnlockToken string
+	// Variant is the A/B variant the visitor was assigned on an earlier visit, if any
+	Variant string
+	// Path is the part of the visited path after the short code ("/a/b"), if
+	// any, and Query the raw query string; both are passed through to the
+	// destination of links that forward them
+	Path  string
+	Query string
+}
+
+// ClickEvent represents a single recorded redirect
+type ClickEvent struct {
+	ID         int64     `json:"id"`
+	ShortCode  string    `json:"short_code"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Referrer   string    `json:"referrer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IPHash     string    `json:"ip_hash,omitempty"`
+	Variant    string    `json:"variant,omitempty"`
+}
+
+// ClickDelta is an aggregated number of clicks to add to a URL's counter
+type ClickDelta struct {
+	ShortCode    string
+	Clicks       int64
+	LastAccessed time.Time
+}
+
+// TimeSeriesPoint is the number of clicks within one analytics bucket
+type TimeSeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Clicks    int64     `json:"clicks"`
+}
+
+// AnalyticsQuery selects the time range and bucket size of an analytics time series
+type AnalyticsQuery struct {
+	From     time.Time
+	To       time.Time
+	Interval AnalyticsInterval
+}
+
+// Normalize fills in defaults relative to now and validates the query
+func (q *AnalyticsQuery) Normalize(now time.Time) error {
+	if q.Interval == "" {
+		q.Interval = IntervalDay
+	}
+	if !q.Interval.Valid() {
+		return errors.New("interval must be one of hour, day, week")
+	}
+	if q.To.IsZero() {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultAnalyticsWindow)
+	}
+	q.From = q.From.UTC()
+	q.To = q.To.UTC()
+
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+
+	buckets := 0
+	for t := q.Interval.Truncate(q.From); t.Before(q.To); t = q.Interval.Next(t) {
+		buckets++
+		if buckets > MaxTimeSeriesBuckets {
+			return errors.New("time range too large for the requested interval")
+		}
+	}
+
+	return nil
+}
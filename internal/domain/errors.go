@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error is an application error carrying a stable machine-readable code, the
+// HTTP status it maps to and a message that is safe to show to clients. The
+// underlying cause, if any, is kept for logging and never sent to clients.
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	// Reason optionally refines Code, e.g. why a destination URL was rejected
+	Reason string
+	// RetryAfter, if set, tells clients how long to wait before trying again
+	RetryAfter time.Duration
+	Err        error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates an application error
+func NewError(status int, code, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+// Invalid creates a 400 error for a request that failed validation
+func Invalid(message string) *Error {
+	return NewError(http.StatusBadRequest, "invalid_request", message)
+}
+
+// URLRejected creates a 400 error for a destination URL refused by the URL
+// policy; reason is a stable code naming the rule that was violated
+func URLRejected(reason, message string) *Error {
+	return &Error{Code: "url_rejected", Status: http.StatusBadRequest, Message: message, Reason: reason}
+}
+
+// NotYetActive creates a 403 error for a link that starts resolving at activatesAt
+func NotYetActive(activatesAt time.Time) *Error {
+	return &Error{
+		Code:       CodeNotYetActive,
+		Status:     http.StatusForbidden,
+		Message:    fmt.Sprintf("URL becomes active at %s", activatesAt.UTC().Format(time.RFC3339)),
+		RetryAfter: time.Until(activatesAt),
+	}
+}
+
+// CodeNotYetActive is the code of errors created by NotYetActive
+const CodeNotYetActive = "not_yet_active"
+
+// Internal wraps an unexpected failure in a 500 error with a generic message
+func Internal(err error) *Error {
+	return &Error{
+		Code:    "internal_error",
+		Status:  http.StatusInternalServerError,
+		Message: "Internal server error",
+		Err:     err,
+	}
+}
+
+// Sentinel errors; compare with errors.Is
+var (
+	// ErrNotFound means the short code never existed (or was deleted)
+	ErrNotFound = NewError(http.StatusNotFound, "not_found", "URL not found")
+	// ErrExpired means the short code exists but has passed its expiry time
+	ErrExpired = NewError(http.StatusGone, "expired", "URL has expired")
+	// ErrDisabled means the short code exists but was disabled by its owner
+	ErrDisabled = NewError(http.StatusGone, "disabled", "URL has been disabled")
+	// ErrClickLimitReached means the short code exists but has been followed as often as allowed
+	ErrClickLimitReached = NewError(http.StatusGone, "click_limit_reached", "URL has reached its click limit")
+	// ErrAliasTaken means a custom alias is already in use
+	ErrAliasTaken = NewError(http.StatusConflict, "alias_taken", "custom alias already exists")
+	// ErrUnauthorized means the endpoint requires an API key
+	ErrUnauthorized = NewError(http.StatusUnauthorized, "unauthorized", "Authentication required")
+	// ErrInvalidAPIKey means the presented API key is malformed, unknown or revoked
+	ErrInvalidAPIKey = NewError(http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+	// ErrRateLimited means the client exceeded its request quota
+	ErrRateLimited = NewError(http.StatusTooManyRequests, "rate_limited", "Rate limit exceeded")
+	// ErrIdempotencyKeyReused means an Idempotency-Key was sent again with a different request
+	ErrIdempotencyKeyReused = NewError(http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+	// ErrIdempotencyInProgress means the original request for an Idempotency-Key has not finished yet
+	ErrIdempotencyInProgress = NewError(http.StatusConflict, "idempotency_in_progress", "A request with this Idempotency-Key is still in progress")
+	// ErrPasswordRequired means the link is password protected and was not unlocked
+	ErrPasswordRequired = NewError(http.StatusUnauthorized, "password_required", "This link is password protected")
+	// ErrInvalidPassword means the password presented to unlock a link is wrong
+	ErrInvalidPassword = NewError(http.StatusForbidden, "invalid_password", "Invalid password")
+	// ErrMethodNotAllowed means the endpoint does not support the request method
+	ErrMethodNotAllowed = NewError(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+)
@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// RedirectType is how visits to a link are answered: with a redirect of the
+// given HTTP status, or with an interstitial page showing the destination
+type RedirectType string
+
+// Supported redirect types. Browsers cache permanent redirects (301, 308), so
+// later visits from the same browser may bypass the shortener and its analytics.
+const (
+	RedirectMovedPermanently  RedirectType = "301"
+	RedirectFound             RedirectType = "302"
+	RedirectTemporaryRedirect RedirectType = "307"
+	RedirectPermanentRedirect RedirectType = "308"
+	RedirectInterstitial      RedirectType = "interstitial"
+)
+
+// IsValid reports whether t is a supported redirect type
+func (t RedirectType) IsValid() bool {
+	switch t {
+	case RedirectMovedPermanently, RedirectFound, RedirectTemporaryRedirect, RedirectPermanentRedirect, RedirectInterstitial:
+		return true
+	}
+	return false
+}
+
+// StatusCode returns the HTTP status of redirects of type t (302 if t is
+// unset), or 0 for interstitials
+func (t RedirectType) StatusCode() int {
+	switch t {
+	case RedirectMovedPermanently:
+		return http.StatusMovedPermanently
+	case RedirectTemporaryRedirect:
+		return http.StatusTemporaryRedirect
+	case RedirectPermanentRedirect:
+		return http.StatusPermanentRedirect
+	case RedirectInterstitial:
+		return 0
+	}
+	return http.StatusFound
+}
+
+// UnmarshalJSON accepts status codes as numbers (301) as well as strings
+func (t *RedirectType) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*t = RedirectType(strconv.Itoa(code))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = RedirectType(s)
+	return nil
+}
+
+// RedirectRule sends visits matching all of its conditions to TargetURL
+// instead of the link's original URL
+type RedirectRule struct {
+	TargetURL  string         `json:"target_url"`
+	Conditions RuleConditions `json:"conditions"`
+}
+
+// RuleConditions are the conditions of a redirect rule. Every condition that
+// is set must match; a condition listing several values matches any of them.
+type RuleConditions struct {
+	// OS matches the visitor's operating system: ios, android, windows, macos,
+	// linux or chromeos
+	OS []string `json:"os,omitempty"`
+	// Devices matches the visitor's device class: mobile, tablet or desktop
+	Devices []string `json:"devices,omitempty"`
+	// Languages matches the visitor's preferred language from Accept-Language;
+	// "de" also matches regional variants such as "de-AT"
+	Languages []string `json:"languages,omitempty"`
+	// Countries matches the ISO 3166-1 alpha-2 code of the visitor's country,
+	// as resolved from the client IP
+	Countries []string `json:"countries,omitempty"`
+	// TimeOfDay matches visits within a daily time window
+	TimeOfDay *TimeWindow `json:"time_of_day,omitempty"`
+}
+
+// TimeWindow is a daily window from From (inclusive) to To (exclusive), both
+// "HH:MM" in TimeZone (UTC if empty). Windows with From after To span midnight.
+type TimeWindow struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// Variant is one destination of an A/B split. Each visitor is assigned one
+// variant, with a probability proportional to its weight.
+type Variant struct {
+	Name      string `json:"name"`
+	TargetURL string `json:"target_url"`
+	Weight    int    `json:"weight"`
+}
+
+// Redirect is everything needed to resolve a visit to a short code: the
+// default destination, the A/B variants that split it, the rules that may
+// override it, whether the visited path and query are passed through and how
+// the visit is answered. It is what the URL cache stores.
+type Redirect struct {
+	URL          string         `json:"url"`
+	Rules        []RedirectRule `json:"rules,omitempty"`
+	Variants     []Variant      `json:"variants,omitempty"`
+	ForwardPath  bool           `json:"forward_path,omitempty"`
+	ForwardQuery bool           `json:"forward_query,omitempty"`
+	Type         RedirectType   `json:"type,omitempty"`
+	Title        string         `json:"title,omitempty"`
+}
+
+// Redirect returns the redirect of the URL
+func (u *URL) Redirect() *Redirect {
+	return &Redirect{
+		URL:          u.OriginalURL,
+		Rules:        u.Rules,
+		Variants:     u.Variants,
+		ForwardPath:  u.ForwardPath,
+		ForwardQuery: u.ForwardQuery,
+		Type:         u.RedirectType,
+		Title:        u.Title,
+	}
+}
+
+// Destination is where a visit to a short code is sent, and how
+type Destination struct {
+	URL string
+	// Variant is the name of the A/B variant the visit was assigned, if any
+	Variant string
+	Type    RedirectType
+	// Title is the link's title, shown on interstitial and preview pages
+	Title string
+}
@@ -8,18 +8,73 @@ type URL struct {
 	ID           int64      `json:"id"`
 	ShortCode    string     `json:"short_code"`
 	OriginalURL  string     `json:"original_url"`
+	CanonicalURL string     `json:"canonical_url"`
 	CreatedAt    time.Time  `json:"created_at"`
+	ActivatesAt  *time.Time `json:"activates_at,omitempty"`
 	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
 	UserID       *string    `json:"user_id,omitempty"`
 	ClickCount   int64      `json:"click_count"`
 	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+	Disabled     bool       `json:"disabled"`
+	// PasswordHash is the bcrypt hash of the password protecting the link, if any
+	PasswordHash *string `json:"-"`
+	// MaxClicks limits how often the link can be followed; ClicksUsed counts
+	// the redirects consumed so far (unlike ClickCount, it is never buffered)
+	MaxClicks  *int64 `json:"max_clicks,omitempty"`
+	ClicksUsed int64  `json:"clicks_used,omitempty"`
+	// Rules redirect matching visits elsewhere, in order; OriginalURL is the fallback
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Variants split the visits not matched by a rule between several destinations
+	Variants []Variant `json:"variants,omitempty"`
+	// ForwardPath appends the path after the short code (/code/a/b) to the
+	// destination's path; ForwardQuery merges the visit's query string into
+	// the destination's
+	ForwardPath  bool `json:"forward_path"`
+	ForwardQuery bool `json:"forward_query"`
+	// RedirectType is how visits are answered; Title is shown on the
+	// interstitial and preview pages
+	RedirectType RedirectType `json:"redirect_type"`
+	Title        string       `json:"title,omitempty"`
+}
+
+// IsProtected reports whether the URL can only be followed after unlocking it
+// with its password
+func (u *URL) IsProtected() bool {
+	return u.PasswordHash != nil
+}
+
+// IsClickLimited reports whether the URL can only be followed a limited number of times
+func (u *URL) IsClickLimited() bool {
+	return u.MaxClicks != nil
+}
+
+// IsPending reports whether the URL has not become active yet as of now
+func (u *URL) IsPending(now time.Time) bool {
+	return u.ActivatesAt != nil && now.Before(*u.ActivatesAt)
+}
+
+// IsExpired reports whether the URL has expired as of now
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
 }
 
 // Analytics represents analytics data for a short URL
 type Analytics struct {
-	ShortCode    string     `json:"short_code"`
-	ClickCount   int64      `json:"click_count"`
-	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+	ShortCode    string            `json:"short_code"`
+	ClickCount   int64             `json:"click_count"`
+	LastAccessed *time.Time        `json:"last_accessed,omitempty"`
+	Interval     AnalyticsInterval `json:"interval,omitempty"`
+	From         *time.Time        `json:"from,omitempty"`
+	To           *time.Time        `json:"to,omitempty"`
+	TimeSeries   []TimeSeriesPoint `json:"time_series,omitempty"`
+	// Variants counts the clicks in the time range per A/B variant
+	Variants []VariantClicks `json:"variants,omitempty"`
+}
+
+// VariantClicks is the number of clicks sent to one A/B variant
+type VariantClicks struct {
+	Variant
+	Clicks int64 `json:"clicks"`
 }
 
 // CreateURLRequest represents the request to create a short URL
@@ -27,10 +82,106 @@ type CreateURLRequest struct {
 	LongURL     string  `json:"long_url"`
 	CustomAlias *string `json:"custom_alias,omitempty"`
 	TTLDays     *int    `json:"ttl_days,omitempty"`
+	// ActivatesAt schedules the link to start resolving at a later time
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	// ExpiresAt ends the link at a precise time; it cannot be combined with TTLDays
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ReuseExisting returns the caller's existing active link for the same
+	// long URL, if any, instead of creating a new one
+	ReuseExisting bool `json:"reuse_existing,omitempty"`
+	// Normalize redirects to the canonical form of the long URL rather than
+	// to the URL exactly as submitted
+	Normalize bool `json:"normalize,omitempty"`
+	// Password protects the link: visitors must unlock it before the redirect
+	Password *string `json:"password,omitempty"`
+	// MaxClicks makes the link stop working after that many redirects
+	// (1 for a one-time link)
+	MaxClicks *int64 `json:"max_clicks,omitempty"`
+	// Rules send visits matching their conditions to other destinations
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Variants split traffic between weighted destinations (e.g. 70/30). If
+	// LongURL is empty, it defaults to the first variant's target.
+	Variants []Variant `json:"variants,omitempty"`
+	// ForwardPath and ForwardQuery pass the rest of the visited path and its
+	// query string through to the destination (one link for a whole site section)
+	ForwardPath  bool `json:"forward_path,omitempty"`
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// RedirectType answers visits with a 301, 302 (the default), 307 or 308
+	// redirect, or with an interstitial page showing the destination first
+	RedirectType RedirectType `json:"redirect_type,omitempty"`
+	// Title is shown on the interstitial and preview pages
+	Title string `json:"title,omitempty"`
 }
 
 // CreateURLResponse represents the response after creating a short URL
 type CreateURLResponse struct {
 	ShortURL  string     `json:"short_url"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reused    bool       `json:"reused,omitempty"`
+}
+
+// UnlockRequest is the request to unlock a password-protected short URL
+type UnlockRequest struct {
+	Password string `json:"password"`
+}
+
+// UnlockResponse is the response after unlocking a password-protected short
+// URL; the unlock itself is carried by a cookie valid until ExpiresAt
+type UnlockResponse struct {
+	ShortURL  string    `json:"short_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Token is the signed unlock token, sent to the visitor as a cookie
+	Token string `json:"-"`
+}
+
+// BatchCreateResult is the outcome of one item of a bulk create request;
+// exactly one of Response and Err is set
+type BatchCreateResult struct {
+	Response *CreateURLResponse
+	Err      error
+}
+
+// UpdateURLRequest represents a partial update of a short URL.
+// Only the fields that are set are changed.
+type UpdateURLRequest struct {
+	LongURL     *string    `json:"long_url,omitempty"`
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	TTLDays     *int       `json:"ttl_days,omitempty"`
+	Disabled    *bool      `json:"disabled,omitempty"`
+	// Normalize redirects to the canonical form of LongURL (see CreateURLRequest)
+	Normalize bool `json:"normalize,omitempty"`
+	// Rules replaces the redirect rules; an empty list removes them
+	Rules *[]RedirectRule `json:"rules,omitempty"`
+	// Variants replaces the A/B variants; an empty list removes them
+	Variants     *[]Variant    `json:"variants,omitempty"`
+	ForwardPath  *bool         `json:"forward_path,omitempty"`
+	ForwardQuery *bool         `json:"forward_query,omitempty"`
+	RedirectType *RedirectType `json:"redirect_type,omitempty"`
+	Title        *string       `json:"title,omitempty"`
+}
+
+// URLStatus filters URLs by expiry state
+type URLStatus string
+
+// Supported URL status filters
+const (
+	URLStatusActive  URLStatus = "active"
+	URLStatusExpired URLStatus = "expired"
+)
+
+// URLFilter selects a page of URLs, newest first
+type URLFilter struct {
+	OwnerID       string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Status        URLStatus
+	BeforeID      int64
+	Limit         int
+}
+
+// URLPage is one page of a URL listing
+type URLPage struct {
+	URLs       []*URL `json:"urls"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
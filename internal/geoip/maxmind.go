@@ -0,0 +1,52 @@
+// Package geoip resolves client IP addresses to countries.
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MaxMindDB looks up countries in a local MaxMind database file, such as
+// GeoLite2-Country.mmdb or GeoIP2-City.mmdb
+type MaxMindDB struct {
+	reader *maxminddb.Reader
+}
+
+// countryRecord is the part of a MaxMind record holding the country
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// OpenMaxMindDB opens the MaxMind database file at path
+func OpenMaxMindDB(path string) (*MaxMindDB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	return &MaxMindDB{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of ip, falling
+// back to the country the address block is registered in, or "" if unknown
+func (db *MaxMindDB) Country(ip net.IP) (string, error) {
+	var record countryRecord
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return "", fmt.Errorf("failed to look up %s: %w", ip, err)
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	return record.RegisteredCountry.ISOCode, nil
+}
+
+// Close releases the database file
+func (db *MaxMindDB) Close() error {
+	return db.reader.Close()
+}
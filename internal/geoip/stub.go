@@ -0,0 +1,57 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Stub resolves countries from a fixed list of networks, for tests and local
+// development without a MaxMind database
+type Stub struct {
+	networks []stubNetwork
+}
+
+type stubNetwork struct {
+	network *net.IPNet
+	country string
+}
+
+// NewStub creates a stub from entries of the form "CIDR=CC" or "IP=CC", for
+// example "203.0.113.0/24=DE". The first matching entry wins.
+func NewStub(entries ...string) (*Stub, error) {
+	s := &Stub{}
+	for _, entry := range entries {
+		addr, country, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !ok || len(country) != 2 {
+			return nil, fmt.Errorf("invalid GeoIP stub entry %q: want CIDR=CC", entry)
+		}
+
+		addr = strings.TrimSpace(addr)
+		if !strings.Contains(addr, "/") {
+			if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+				addr += "/32"
+			} else {
+				addr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GeoIP stub entry %q: %w", entry, err)
+		}
+		s.networks = append(s.networks, stubNetwork{network: network, country: country})
+	}
+	return s, nil
+}
+
+// Country returns the country of the first network containing ip, or "" if
+// there is none
+func (s *Stub) Country(ip net.IP) (string, error) {
+	for _, n := range s.networks {
+		if n.network.Contains(ip) {
+			return n.country, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,41 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+func TestStub_Country(t *testing.T) {
+	stub, err := NewStub("203.0.113.0/24=de", "198.51.100.7=FR", "2001:db8::/32=NL")
+	if err != nil {
+		t.Fatalf("NewStub failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.42", "DE"},
+		{"198.51.100.7", "FR"},
+		{"198.51.100.8", ""},
+		{"2001:db8::1", "NL"},
+		{"192.0.2.1", ""},
+	}
+	for _, tt := range tests {
+		got, err := stub.Country(net.ParseIP(tt.ip))
+		if err != nil {
+			t.Fatalf("Country(%s) failed: %v", tt.ip, err)
+		}
+		if got != tt.want {
+			t.Errorf("Country(%s) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestNewStub_InvalidEntries(t *testing.T) {
+	for _, entry := range []string{"203.0.113.0/24", "203.0.113.0/24=DEU", "not-an-ip=DE", "203.0.113.0/40=DE"} {
+		if _, err := NewStub(entry); err == nil {
+			t.Errorf("NewStub(%q) succeeded, want error", entry)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/service"
+)
+
+// contextKey is the type of request context keys set by this package
+type contextKey string
+
+const userIDKey contextKey = "user_id"
+
+// AuthMiddleware resolves an "Authorization: Bearer <key>" header to a user and
+// stores the user ID in the request context. Requests without the header pass
+// through anonymously; requests with an invalid key are rejected.
+func AuthMiddleware(auth *service.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, rawKey, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				respondWithError(w, r, domain.NewError(http.StatusUnauthorized, domain.ErrInvalidAPIKey.Code, "Authorization header must use the Bearer scheme"))
+				return
+			}
+
+			userID, err := auth.Authenticate(r.Context(), strings.TrimSpace(rawKey))
+			if err != nil {
+				respondWithError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), userID)))
+		})
+	}
+}
+
+// RequireAuth rejects requests that AuthMiddleware did not resolve to a user
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userIDFromContext(r.Context()) == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, r, domain.ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withUserID returns a copy of ctx carrying the authenticated user ID
+func withUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// userIDFromContext returns the authenticated user ID, or "" for anonymous requests
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	auth := service.NewAuthService(repository.NewMemoryRepository())
+	rawKey, key, err := auth.CreateAPIKey(context.Background(), "", "test")
+	if err != nil {
+		t.Fatalf("CreateAPIKey returned error: %v", err)
+	}
+
+	var gotUserID string
+	handler := AuthMiddleware(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID = userIDFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantUserID string
+	}{
+		{"Anonymous", "", http.StatusOK, ""},
+		{"Valid key", "Bearer " + rawKey, http.StatusOK, key.UserID},
+		{"Invalid key", "Bearer usk_nope", http.StatusUnauthorized, ""},
+		{"Wrong scheme", "Basic " + rawKey, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID = ""
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/urls", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if gotUserID != tt.wantUserID {
+				t.Errorf("Expected user ID %q, got %q", tt.wantUserID, gotUserID)
+			}
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous request: expected status 401, got %d", w.Code)
+	}
+
+	req = req.WithContext(withUserID(req.Context(), "user"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Authenticated request: expected status 200, got %d", w.Code)
+	}
+}
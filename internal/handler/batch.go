@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"url-shortener/internal/domain"
+)
+
+// maxBatchBodyBytes bounds the size of a bulk upload
+const maxBatchBodyBytes = 10 << 20
+
+// errPayloadTooLarge is returned when a bulk upload exceeds maxBatchBodyBytes
+var errPayloadTooLarge = domain.NewError(http.StatusRequestEntityTooLarge, "payload_too_large", "Request body too large")
+
+// batchResponse is the response of a bulk create
+type batchResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []batchItemResult `json:"results"`
+}
+
+// batchItemResult is the outcome of one item of a bulk create, in upload order
+type batchItemResult struct {
+	Index int `json:"index"`
+	*domain.CreateURLResponse
+	Error *errorBody `json:"error,omitempty"`
+}
+
+// CreateShortURLBatch handles POST /api/v1/urls/batch. The body is a JSON array
+// of create requests, or the same requests streamed as NDJSON
+// (application/x-ndjson) or CSV (text/csv) with a header row naming the
+// long_url, custom_alias and ttl_days columns.
+func (h *URLHandler) CreateShortURLBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	reqs, err := decodeBatch(body, r.Header.Get("Content-Type"), h.urlService.MaxBatchSize())
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, r, errPayloadTooLarge)
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	results, err := h.urlService.ShortenURLs(r.Context(), reqs, userIDFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	resp := batchResponse{Results: make([]batchItemResult, len(results))}
+	for i, result := range results {
+		item := batchItemResult{Index: i, CreateURLResponse: result.Response}
+		if result.Err != nil {
+			var appErr *domain.Error
+			if !errors.As(result.Err, &appErr) {
+				appErr = domain.Internal(result.Err)
+			}
+			item.Error = &errorBody{Code: appErr.Code, Message: appErr.Message, Reason: appErr.Reason}
+			resp.Failed++
+		} else {
+			resp.Created++
+		}
+		resp.Results[i] = item
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// decodeBatch reads up to limit create requests from body in the format named
+// by contentType, failing as soon as the upload holds more than limit items
+func decodeBatch(body io.Reader, contentType string, limit int) ([]*domain.CreateURLRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var reqs []*domain.CreateURLRequest
+	add := func(req *domain.CreateURLRequest) error {
+		if len(reqs) == limit {
+			return domain.Invalid(fmt.Sprintf("at most %d URLs can be created at once", limit))
+		}
+		reqs = append(reqs, req)
+		return nil
+	}
+
+	var err error
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		err = decodeNDJSON(body, add)
+	case "text/csv":
+		err = decodeCSV(body, add)
+	default:
+		err = decodeJSONArray(body, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reqs, nil
+}
+
+// decodeJSONArray streams the elements of a JSON array of create requests into add
+func decodeJSONArray(body io.Reader, add func(*domain.CreateURLRequest) error) error {
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return decodeError(err, "Request body must be a JSON array")
+	}
+
+	for i := 0; dec.More(); i++ {
+		var req domain.CreateURLRequest
+		if err := dec.Decode(&req); err != nil {
+			return decodeError(err, fmt.Sprintf("Invalid item %d", i))
+		}
+		if err := add(&req); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return decodeError(err, "Request body must be a JSON array")
+	}
+	return nil
+}
+
+// decodeNDJSON streams newline-delimited create requests into add
+func decodeNDJSON(body io.Reader, add func(*domain.CreateURLRequest) error) error {
+	dec := json.NewDecoder(body)
+	for i := 0; ; i++ {
+		var req domain.CreateURLRequest
+		err := dec.Decode(&req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return decodeError(err, fmt.Sprintf("Invalid item %d", i))
+		}
+		if err := add(&req); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeCSV streams the rows of a CSV upload into add. The header row names
+// the columns; long_url is required and custom_alias and ttl_days are optional.
+func decodeCSV(body io.Reader, add func(*domain.CreateURLRequest) error) error {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return domain.Invalid("CSV upload must start with a header row")
+	}
+	if err != nil {
+		return decodeError(err, "Invalid CSV header")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case "long_url", "custom_alias", "ttl_days":
+			columns[name] = i
+		default:
+			return domain.Invalid(fmt.Sprintf("unknown CSV column %q", name))
+		}
+	}
+	if _, ok := columns["long_url"]; !ok {
+		return domain.Invalid("CSV header must include long_url")
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return decodeError(err, fmt.Sprintf("Invalid CSV row %d", row))
+		}
+
+		req := &domain.CreateURLRequest{LongURL: record[columns["long_url"]]}
+		if i, ok := columns["custom_alias"]; ok && record[i] != "" {
+			alias := record[i]
+			req.CustomAlias = &alias
+		}
+		if i, ok := columns["ttl_days"]; ok && record[i] != "" {
+			ttl, err := strconv.Atoi(record[i])
+			if err != nil {
+				return domain.Invalid(fmt.Sprintf("Invalid CSV row %d: ttl_days must be an integer", row))
+			}
+			req.TTLDays = &ttl
+		}
+
+		if err := add(req); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeError reports a malformed upload as invalid, passing body size errors
+// through so that they can be answered with 413
+func decodeError(err error, message string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return domain.Invalid(message)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+)
+
+func TestCreateShortURLBatch_Formats(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `[{"long_url": "https://example.com/a", "custom_alias": "first"}, {"long_url": "bad"}, {"long_url": "https://example.com/c", "ttl_days": 3}]`},
+		{"ndjson", "application/x-ndjson", "{\"long_url\": \"https://example.com/a\", \"custom_alias\": \"first\"}\n{\"long_url\": \"bad\"}\n{\"long_url\": \"https://example.com/c\", \"ttl_days\": 3}\n"},
+		{"csv", "text/csv; charset=utf-8", "long_url,custom_alias,ttl_days\nhttps://example.com/a,first,\nbad,,\nhttps://example.com/c,,3\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _ := newTestHandler()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = req.WithContext(withUserID(req.Context(), "owner"))
+			w := httptest.NewRecorder()
+
+			handler.CreateShortURLBatch(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var resp batchResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Created != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+				t.Fatalf("Expected 2 created and 1 failed, got %+v", resp)
+			}
+			if resp.Results[0].CreateURLResponse == nil || resp.Results[0].ShortURL != "http://sho.rt/first" {
+				t.Errorf("Expected first item to use its alias, got %+v", resp.Results[0])
+			}
+			if resp.Results[1].Error == nil || resp.Results[1].Error.Code != "url_rejected" || resp.Results[1].Error.Reason != "invalid_url" {
+				t.Errorf("Expected second item to fail validation, got %+v", resp.Results[1])
+			}
+			if resp.Results[2].CreateURLResponse == nil || resp.Results[2].ExpiresAt == nil {
+				t.Errorf("Expected third item to be created with an expiry, got %+v", resp.Results[2])
+			}
+		})
+	}
+}
+
+func TestCreateShortURLBatch_Rejected(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	svc := service.NewURLService(store, repository.NewMemoryCache(), "http://sho.rt", service.WithMaxBatchSize(2))
+	handler := NewURLHandler(svc)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"too many items", "application/json", `[{"long_url": "https://a.com"}, {"long_url": "https://b.com"}, {"long_url": "https://c.com"}]`},
+		{"not an array", "application/json", `{"long_url": "https://a.com"}`},
+		{"malformed ndjson", "application/x-ndjson", "{\"long_url\": \"https://a.com\"}\n{oops}\n"},
+		{"unknown csv column", "text/csv", "long_url,campaign\nhttps://a.com,spring\n"},
+		{"csv without long_url", "text/csv", "custom_alias\nabc\n"},
+		{"empty", "application/json", `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.CreateShortURLBatch(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
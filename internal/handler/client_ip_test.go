@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies returned error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		xri        string
+		want       string
+	}{
+		{"direct", "203.0.113.9:1234", nil, "", "203.0.113.9"},
+		{"spoofed XFF from a client", "203.0.113.9:1234", []string{"198.51.100.1"}, "", "203.0.113.9"},
+		{"spoofed X-Real-IP from a client", "203.0.113.9:1234", nil, "198.51.100.1", "203.0.113.9"},
+		{"through a proxy", testIP, []string{"203.0.113.7"}, "", "203.0.113.7"},
+		{"spoofed entry before the proxy's", testIP, []string{"198.51.100.1, 203.0.113.7"}, "", "203.0.113.7"},
+		{"proxy chain", "10.0.0.2:80", []string{"198.51.100.1, 203.0.113.7", "10.0.0.5"}, "", "203.0.113.7"},
+		{"garbage entry", testIP, []string{"203.0.113.7, not-an-ip"}, "", "192.168.1.1"},
+		{"X-Real-IP through a proxy", testIP, nil, "203.0.113.7", "203.0.113.7"},
+		{"only proxies", testIP, []string{"10.0.0.3"}, "", "10.0.0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIPMiddleware(proxies)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = getClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			if tt.xri != "" {
+				req.Header.Set("X-Real-IP", tt.xri)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("Expected client IP %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIPMiddleware_NoTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.RemoteAddr = testIP
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	if ip := resolveClientIP(req, nil); ip != "192.168.1.1" {
+		t.Errorf("Expected forwarding headers to be ignored without trusted proxies, got %q", ip)
+	}
+	if ip := getClientIP(req); ip != "192.168.1.1" {
+		t.Errorf("Expected the remote address outside the middleware, got %q", ip)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::1", "fd00::/8"}); err != nil {
+		t.Errorf("ParseTrustedProxies returned error: %v", err)
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.internal"}); err == nil {
+		t.Error("Expected an error for a host name")
+	}
+}
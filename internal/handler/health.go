@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DependencyCheck is a dependency the server needs to serve traffic, such as a
+// database. Ping returns an error if the dependency is unreachable.
+type DependencyCheck struct {
+	Name string
+	Ping func(ctx context.Context) error
+}
+
+// HealthHandler answers liveness and readiness probes
+type HealthHandler struct {
+	checks   []DependencyCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewHealthHandler creates a health handler whose readiness probe pings every
+// one of checks, each within timeout
+func NewHealthHandler(timeout time.Duration, checks ...DependencyCheck) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: timeout}
+}
+
+// healthResponse is the body of liveness and readiness probes
+type healthResponse struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]dependencyStatus `json:"dependencies,omitempty"`
+}
+
+// dependencyStatus is the outcome of pinging one dependency
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Live handles GET /livez. The process is alive as long as it can answer, so
+// this never checks dependencies: restarting the pod would not fix them.
+func (h *HealthHandler) Live(w http.ResponseWriter, _ *http.Request) {
+	respondWithJSON(w, http.StatusOK, healthResponse{Status: "healthy"})
+}
+
+// Ready handles GET /readyz (and /health). It pings all dependencies in
+// parallel and answers 503 if any of them is down or the server is shutting down.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		respondWithJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	statuses := make([]dependencyStatus, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check DependencyCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Ping(ctx)
+			statuses[i] = dependencyStatus{Status: "up", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				statuses[i].Status = "down"
+				slog.WarnContext(ctx, "Readiness check failed", "dependency", check.Name, "error", err)
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	response := healthResponse{Status: "healthy", Dependencies: make(map[string]dependencyStatus, len(h.checks))}
+	status := http.StatusOK
+	for i, check := range h.checks {
+		response.Dependencies[check.Name] = statuses[i]
+		if statuses[i].Status != "up" {
+			response.Status = "unhealthy"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	respondWithJSON(w, status, response)
+}
+
+// Drain makes the readiness probe fail from now on, so load balancers stop
+// sending new traffic while in-flight requests finish
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler_Live(t *testing.T) {
+	failing := DependencyCheck{Name: "postgres", Ping: func(context.Context) error { return errors.New("connection refused") }}
+	handler := NewHealthHandler(time.Second, failing)
+
+	w := httptest.NewRecorder()
+	handler.Live(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected liveness to ignore dependencies, got status %d", w.Code)
+	}
+}
+
+func TestHealthHandler_Ready(t *testing.T) {
+	up := DependencyCheck{Name: "postgres", Ping: func(context.Context) error { return nil }}
+	hanging := DependencyCheck{Name: "redis", Ping: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name   string
+		checks []DependencyCheck
+		status int
+		body   string
+		redis  string
+	}{
+		{"all up", []DependencyCheck{up, {Name: "redis", Ping: up.Ping}}, http.StatusOK, "healthy", "up"},
+		{"redis times out", []DependencyCheck{up, hanging}, http.StatusServiceUnavailable, "unhealthy", "down"},
+	}
+	for _, tt := range tests {
+		handler := NewHealthHandler(50*time.Millisecond, tt.checks...)
+
+		w := httptest.NewRecorder()
+		handler.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var response healthResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.name, err)
+		}
+		if w.Code != tt.status || response.Status != tt.body {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.name, tt.status, tt.body, w.Code, response.Status)
+		}
+		if response.Dependencies["postgres"].Status != "up" || response.Dependencies["redis"].Status != tt.redis {
+			t.Errorf("%s: unexpected dependencies %+v", tt.name, response.Dependencies)
+		}
+		if tt.redis == "down" && response.Dependencies["redis"].LatencyMS < 50 {
+			t.Errorf("%s: expected the latency to cover the timeout, got %vms", tt.name, response.Dependencies["redis"].LatencyMS)
+		}
+	}
+}
+
+func TestHealthHandler_Drain(t *testing.T) {
+	pinged := false
+	handler := NewHealthHandler(time.Second, DependencyCheck{Name: "postgres", Ping: func(context.Context) error {
+		pinged = true
+		return nil
+	}})
+	handler.Drain()
+
+	w := httptest.NewRecorder()
+	handler.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while draining, got %d", w.Code)
+	}
+	if pinged {
+		t.Error("Expected no dependency pings while draining")
+	}
+}
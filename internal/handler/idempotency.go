@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/repository"
+)
+
+// Idempotency-Key handling limits
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 1 << 20
+	// idempotencyLockTTL bounds how long a key stays reserved if its request
+	// never completes, e.g. because the server crashed while handling it
+	idempotencyLockTTL = time.Minute
+)
+
+// IdempotencyMiddleware replays the stored response of a request retried with
+// the same Idempotency-Key header within ttl. Keys are scoped to the
+// authenticated user (or client IP); reusing a key for a different request is
+// rejected. Server errors are not stored, so such requests can be retried, and
+// requests fail rather than risk duplicates when the store is unavailable.
+func IdempotencyMiddleware(store repository.IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				respondWithError(w, r, domain.Invalid("Idempotency-Key must be at most 255 characters"))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				respondWithError(w, r, domain.Invalid("Invalid request payload"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scope := userIDFromContext(r.Context())
+			if scope == "" {
+				scope = "ip:" + getClientIP(r)
+			}
+			storeKey := scope + ":" + key
+			requestHash := hashRequest(r, body)
+
+			existing, reserved, err := store.ReserveIdempotencyKey(r.Context(), storeKey,
+				&repository.IdempotencyRecord{RequestHash: requestHash, Pending: true}, idempotencyLockTTL)
+			if err != nil {
+				respondWithError(w, r, domain.Internal(err))
+				return
+			}
+			if !reserved {
+				replayIdempotent(w, r, existing, requestHash)
+				return
+			}
+
+			rec := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// The outcome is stored even if the client has gone away meanwhile
+			ctx := context.WithoutCancel(r.Context())
+			if rec.statusCode >= http.StatusInternalServerError {
+				err = store.DeleteIdempotencyKey(ctx, storeKey)
+			} else {
+				err = store.SaveIdempotencyRecord(ctx, storeKey, &repository.IdempotencyRecord{
+					RequestHash: requestHash,
+					StatusCode:  rec.statusCode,
+					ContentType: rec.Header().Get("Content-Type"),
+					Body:        rec.body.Bytes(),
+				}, ttl)
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to store idempotent response", "error", err)
+			}
+		})
+	}
+}
+
+// replayIdempotent answers a request whose Idempotency-Key is already in use
+func replayIdempotent(w http.ResponseWriter, r *http.Request, record *repository.IdempotencyRecord, requestHash string) {
+	switch {
+	case record.RequestHash != requestHash:
+		respondWithError(w, r, domain.ErrIdempotencyKeyReused)
+	case record.Pending:
+		respondWithError(w, r, domain.ErrIdempotencyInProgress)
+	default:
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(record.StatusCode)
+		_, _ = w.Write(record.Body)
+	}
+}
+
+// hashRequest fingerprints a request so a reused key can be told apart from a retry
+func hashRequest(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingResponseWriter captures the status code and body written through it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
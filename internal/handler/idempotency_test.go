@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/repository"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	handler, _ := newTestHandler()
+	idempotent := IdempotencyMiddleware(repository.NewMemoryCache(), time.Hour)(http.HandlerFunc(handler.CreateShortURL))
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		req = req.WithContext(withUserID(req.Context(), "owner"))
+		w := httptest.NewRecorder()
+		idempotent.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("key-1", `{"long_url": "https://example.com"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", first.Code)
+	}
+
+	retry := post("key-1", `{"long_url": "https://example.com"}`)
+	if retry.Code != http.StatusCreated {
+		t.Errorf("Expected replayed status 201, got %d", retry.Code)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected replayed response to be marked")
+	}
+	if !bytes.Equal(retry.Body.Bytes(), first.Body.Bytes()) {
+		t.Errorf("Expected replayed body %q, got %q", first.Body.String(), retry.Body.String())
+	}
+
+	if w := post("key-1", `{"long_url": "https://example.org"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a reused key, got %d", w.Code)
+	}
+
+	other := post("key-2", `{"long_url": "https://example.com"}`)
+	if other.Code != http.StatusCreated || other.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("Expected a new key to create a new link, got %d", other.Code)
+	}
+	var a, b domain.CreateURLResponse
+	_ = json.Unmarshal(first.Body.Bytes(), &a)
+	_ = json.Unmarshal(other.Body.Bytes(), &b)
+	if a.ShortURL == b.ShortURL {
+		t.Errorf("Expected distinct short URLs, both were %q", a.ShortURL)
+	}
+}
+
+func TestIdempotencyMiddleware_InProgressAndServerErrors(t *testing.T) {
+	store := repository.NewMemoryCache()
+	calls := 0
+	failing := IdempotencyMiddleware(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		respondWithError(w, r, domain.Internal(nil))
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "key")
+		w := httptest.NewRecorder()
+		failing.ServeHTTP(w, req)
+		return w
+	}
+
+	send()
+	send()
+	if calls != 2 {
+		t.Errorf("Expected server errors not to be replayed, handler ran %d times", calls)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(`{}`))
+	_, _, _ = store.ReserveIdempotencyKey(req.Context(), "ip:192.0.2.1:busy",
+		&repository.IdempotencyRecord{RequestHash: hashRequest(req, []byte(`{}`)), Pending: true}, time.Minute)
+	req.Header.Set("Idempotency-Key", "busy")
+	w := httptest.NewRecorder()
+	failing.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 while the original request runs, got %d", w.Code)
+	}
+}
@@ -2,19 +2,58 @@
 package handler
 
 import (
-	"log"
-	"net"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// RateLimiter implements a simple token bucket rate limiter per IP
+// RateLimiter implements a simple token bucket rate limiter per IP, or per
+// another request key (see WithRequestKey)
 type RateLimiter struct {
 	visitors map[string]*visitor
 	mu       sync.RWMutex
 	rate     int           // requests per minute
 	interval time.Duration // time window
+	key      func(*http.Request) string
+
+	metrics *metrics.Metrics
+	name    string
+}
+
+// RateLimiterOption configures optional RateLimiter behaviour
+type RateLimiterOption func(*RateLimiter)
+
+// WithRejectionMetrics counts the requests the limiter rejects in m, labelled
+// with the limiter's name
+func WithRejectionMetrics(m *metrics.Metrics, name string) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.metrics = m
+		rl.name = name
+	}
+}
+
+// WithRequestKey makes the limiter count requests per key(r) instead of per
+// client IP
+func WithRequestKey(key func(r *http.Request) string) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.key = key
+	}
 }
 
 type visitor struct {
@@ -24,11 +63,15 @@ type visitor struct {
 }
 
 // NewRateLimiter creates a new rate limiter
-func NewRateLimiter(requestsPerMinute int) *RateLimiter {
+func NewRateLimiter(requestsPerMinute int, opts ...RateLimiterOption) *RateLimiter {
 	rl := &RateLimiter{
 		visitors: make(map[string]*visitor),
 		rate:     requestsPerMinute,
 		interval: time.Minute,
+		key:      getClientIP,
+	}
+	for _, opt := range opts {
+		opt(rl)
 	}
 
 	// Cleanup old visitors every 5 minutes
@@ -90,12 +133,10 @@ func (rl *RateLimiter) cleanupVisitors() {
 func RateLimitMiddleware(rl *RateLimiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get client IP
-			ip := getClientIP(r)
-
 			// Check rate limit
-			if !rl.Allow(ip) {
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			if !rl.Allow(rl.key(r)) {
+				rl.metrics.RateLimited(rl.name)
+				respondWithError(w, r, domain.ErrRateLimited)
 				return
 			}
 
@@ -104,33 +145,130 @@ func RateLimitMiddleware(rl *RateLimiter) func(http.Handler) http.Handler {
 	}
 }
 
-// LoggingMiddleware logs HTTP requests
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+// LoggingMiddleware logs HTTP requests and records their count and latency in
+// m (if not nil), labelled with the route that route returns for the request
+func LoggingMiddleware(m *metrics.Metrics, route func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			// Create a response writer wrapper to capture status code
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next.ServeHTTP(wrapped, r)
+
+			duration := time.Since(start)
+			m.ObserveRequest(route(r), r.Method, wrapped.statusCode, duration)
+			slog.InfoContext(r.Context(), "Request handled",
+				"method", r.Method,
+				"path", r.RequestURI,
+				"status", wrapped.statusCode,
+				"duration", duration,
+			)
+		})
+	}
+}
+
+// TracingMiddleware starts a server span for every request, continuing the
+// trace of an incoming W3C traceparent header. Spans are named by the method
+// and the route that route returns for the request.
+func TracingMiddleware(route func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			pattern := route(r)
+			ctx, span := tracing.Start(ctx, r.Method+" "+pattern,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(pattern),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
+			defer span.End()
+			if id := logging.RequestID(ctx); id != "" {
+				span.SetAttributes(attribute.String(logging.RequestIDKey, id))
+			}
+
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(wrapped.statusCode))
+			if wrapped.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+			}
+		})
+	}
+}
+
+// MuxRoute returns a route function for LoggingMiddleware naming requests by
+// the pattern mux routes them by, so e.g. all redirects share the route "/"
+func MuxRoute(mux *http.ServeMux) func(*http.Request) string {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+}
+
+// requestIDHeader carries the ID of a request in both directions
+const requestIDHeader = "X-Request-ID"
 
-		// Create a response writer wrapper to capture status code
-		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
 
-		next.ServeHTTP(wrapped, r)
+// RequestIDMiddleware gives every request an ID: the client's X-Request-ID if
+// it is usable, else a random one. The ID is echoed in the response and put in
+// the request context, so every log record made for the request carries it.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
 
-		log.Printf(
-			"%s %s %d %s",
-			r.Method,
-			r.RequestURI,
-			wrapped.statusCode,
-			time.Since(start),
-		)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
 	})
 }
 
+// validRequestID reports whether id is a non-empty, bounded run of printable
+// ASCII, so client-chosen IDs cannot inject anything into logs or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit request ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID of r, as assigned by RequestIDMiddleware or, where
+// that does not run, as sent by the client
+func requestID(r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+	return r.Header.Get(requestIDHeader)
+}
+
 // RecoveryMiddleware recovers from panics
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				respondWithError(w, r, domain.Internal(fmt.Errorf("panic recovered: %v", err)))
 			}
 		}()
 
@@ -143,7 +281,8 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -164,27 +303,3 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
-
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// Take the first IP in the list
-		return xff
-	}
-
-	// Check X-Real-IP header
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
-	}
-
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-
-	return ip
-}
@@ -1,9 +1,23 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 const testIP = "192.168.1.1:1234"
@@ -93,3 +107,138 @@ func TestCORS(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 }
+
+func TestLoggingMiddleware_Metrics(t *testing.T) {
+	m := metrics.New()
+	limiter := NewRateLimiter(1, WithRejectionMetrics(m, "create"))
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/urls", RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com", http.StatusFound)
+	})
+	handler := LoggingMiddleware(m, MuxRoute(mux))(mux)
+
+	for _, path := range []string{"/abc", "/xyz", "/api/v1/urls", "/api/v1/urls"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = testIP
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`shortener_http_requests_total{method="POST",route="/",status="302"} 2`,
+		`shortener_http_requests_total{method="POST",route="/api/v1/urls",status="201"} 1`,
+		`shortener_http_requests_total{method="POST",route="/api/v1/urls",status="429"} 1`,
+		`shortener_rate_limited_requests_total{limiter="create"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected the metrics to contain %q", want)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		respondWithError(w, r, domain.ErrNotFound)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"client ID", "req-123", true},
+		{"missing", "", false},
+		{"control characters", "req\r\n123", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Request-ID", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		id := w.Header().Get("X-Request-ID")
+		if tt.keep && id != tt.header {
+			t.Errorf("%s: expected the request ID %q to be echoed, got %q", tt.name, tt.header, id)
+		}
+		if !tt.keep && (len(id) != 32 || id == tt.header) {
+			t.Errorf("%s: expected a generated request ID, got %q", tt.name, id)
+		}
+		if seen != id {
+			t.Errorf("%s: expected the context to carry %q, got %q", tt.name, id, seen)
+		}
+		if !strings.Contains(w.Body.String(), `"request_id":"`+id+`"`) {
+			t.Errorf("%s: expected the error body to carry the request ID, got %s", tt.name, w.Body.String())
+		}
+	}
+}
+
+// recordSpans installs a tracer provider exporting to memory for the test
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return exporter
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := recordSpans(t)
+
+	alias := "traced"
+	svc := service.NewURLService(repository.NewMemoryRepository(), repository.NewMemoryCache(), "http://sho.rt")
+	if _, err := svc.ShortenURL(context.Background(), &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, ""); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	exporter.Reset()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", NewURLHandler(svc).RedirectToOriginal)
+	handler := RequestIDMiddleware(TracingMiddleware(MuxRoute(mux))(mux))
+
+	req := httptest.NewRequest(http.MethodGet, "/traced", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Request-ID", "req-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d", w.Code)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	server, ok := spans["GET /"]
+	if !ok {
+		t.Fatalf("Expected a server span named %q, got %v", "GET /", exporter.GetSpans())
+	}
+	if server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the server span to continue the incoming trace, got trace %s parent %s",
+			server.SpanContext.TraceID(), server.Parent.SpanID())
+	}
+	attrs := make(map[string]string)
+	for _, attr := range server.Attributes {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["http.route"] != "/" || attrs["http.response.status_code"] != "302" || attrs["request_id"] != "req-123" {
+		t.Errorf("Unexpected server span attributes: %v", attrs)
+	}
+
+	lookup, ok := spans["URLService.GetOriginalURL"]
+	if !ok || lookup.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("Expected the service span to be a child of the server span, got %v", exporter.GetSpans())
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"url-shortener/internal/domain"
+)
+
+// previewSuffix appended to a short code shows the link's preview page
+// instead of following it
+const previewSuffix = "+"
+
+//go:embed templates/preview.html
+var templates embed.FS
+
+// previewTemplate renders both the preview page and the interstitial page of
+// links with the interstitial redirect type
+var previewTemplate = template.Must(template.ParseFS(templates, "templates/preview.html"))
+
+// previewPage is the data of previewTemplate
+type previewPage struct {
+	Title        string
+	URL          string
+	Host         string
+	Interstitial bool
+}
+
+// respondPreview shows the destination of a link with a button to continue
+// there. Interstitials are answered in place of the link's redirect; previews
+// are requested explicitly with previewSuffix.
+func respondPreview(w http.ResponseWriter, r *http.Request, dest *domain.Destination, interstitial bool) {
+	page := previewPage{Title: dest.Title, URL: dest.URL, Host: dest.URL, Interstitial: interstitial}
+	if u, err := url.Parse(dest.URL); err == nil && u.Host != "" {
+		page.Host = u.Host
+	}
+
+	var buf bytes.Buffer
+	if err := previewTemplate.Execute(&buf, page); err != nil {
+		respondWithError(w, r, domain.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
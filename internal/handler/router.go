@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"url-shortener/internal/domain"
+)
+
+// MethodHandler dispatches a request to the handler registered for its HTTP method
+// and answers 405 Method Not Allowed otherwise
+type MethodHandler map[string]http.Handler
+
+// ServeHTTP implements http.Handler
+func (m MethodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m[r.Method]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	respondWithError(w, r, domain.ErrMethodNotAllowed)
+}
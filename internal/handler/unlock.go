@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"url-shortener/internal/domain"
+)
+
+// unlockPathPrefix is the path prefix of the endpoint unlocking protected links
+const unlockPathPrefix = "/api/v1/unlock/"
+
+// unlockCookieName is the cookie carrying the token of an unlocked link. Each
+// link has its own, named after its short code (see linkCookieName).
+const unlockCookieName = "link_unlock"
+
+// passwordChallenge answers API clients following a password-protected link
+type passwordChallenge struct {
+	Error     errorBody `json:"error"`
+	UnlockURL string    `json:"unlock_url"`
+}
+
+// UnlockURL handles POST /api/v1/unlock/{short_code}. The password is sent as
+// JSON or as a form field; on success the response sets the cookie that
+// unlocks the redirect for a short while.
+func (h *URLHandler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
+		return
+	}
+
+	shortCode := shortCodeFromPath(r, unlockPathPrefix)
+	if shortCode == "" {
+		respondWithError(w, r, domain.Invalid("short_code is required"))
+		return
+	}
+
+	var req domain.UnlockRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		req.Password = r.PostFormValue("password")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, r, domain.Invalid("Invalid request payload"))
+		return
+	}
+	if req.Password == "" {
+		respondWithError(w, r, domain.Invalid("password is required"))
+		return
+	}
+
+	resp, err := h.urlService.UnlockURL(r.Context(), shortCode, req.Password)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkCookieName(unlockCookieName, shortCode),
+		Value:    resp.Token,
+		Path:     "/",
+		Expires:  resp.ExpiresAt,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// UnlockShortCode returns the short code an unlock request is for. Keying a
+// rate limiter by it caps the password guesses against one link, however many
+// addresses they come from.
+func UnlockShortCode(r *http.Request) string {
+	return shortCodeFromPath(r, unlockPathPrefix)
+}
+
+// respondPasswordRequired answers a redirect to a password-protected link:
+// API clients get a JSON challenge naming the unlock endpoint, browsers are
+// sent on to the frontend's unlock page
+func respondPasswordRequired(w http.ResponseWriter, r *http.Request, shortCode string) {
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		respondLinkUnavailable(w, http.StatusUnauthorized, "/unlock?code="+url.QueryEscape(shortCode), "Password required")
+		return
+	}
+
+	respondWithJSON(w, http.StatusUnauthorized, passwordChallenge{
+		Error: errorBody{
+			Code:      domain.ErrPasswordRequired.Code,
+			Message:   domain.ErrPasswordRequired.Message,
+			RequestID: requestID(r),
+		},
+		UnlockURL: unlockPathPrefix + shortCode,
+	})
+}
+
+// isHTTPS reports whether the client reached us over HTTPS, directly or
+// through a TLS-terminating proxy
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/domain"
+)
+
+func TestUnlockURL(t *testing.T) {
+	handler, _ := newTestHandler()
+	alias, password := "secret", "hunter22"
+	_, err := handler.urlService.ShortenURL(context.Background(), &domain.CreateURLRequest{
+		LongURL:     "https://example.com/internal",
+		CustomAlias: &alias,
+		Password:    &password,
+	}, "")
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	visit := func(path string, cookie *http.Cookie, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.RedirectToOriginal(w, req)
+		return w
+	}
+	redirect := func(cookie *http.Cookie, accept string) *httptest.ResponseRecorder {
+		return visit("/secret", cookie, accept)
+	}
+	unlock := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/unlock/secret", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.UnlockURL(w, req)
+		return w
+	}
+
+	w := redirect(nil, "application/json")
+	var challenge passwordChallenge
+	if err := json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	if w.Code != http.StatusUnauthorized || challenge.Error.Code != "password_required" || challenge.UnlockURL != "/api/v1/unlock/secret" {
+		t.Errorf("Expected a password challenge, got %d %+v", w.Code, challenge)
+	}
+
+	w = redirect(nil, "text/html")
+	if w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte("/unlock?code=secret")) {
+		t.Errorf("Expected browsers to be sent to the unlock page, got %d %q", w.Code, w.Body.String())
+	}
+
+	if w := unlock("application/json", `{"password": "wrong"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a wrong password, got %d", w.Code)
+	}
+
+	w = unlock("application/x-www-form-urlencoded", "password=hunter22")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "link_unlock_secret" || cookies[0].Path != "/" || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly unlock cookie keyed by the link, got %+v", cookies)
+	}
+
+	w = redirect(cookies[0], "application/json")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/internal" {
+		t.Errorf("Expected the unlocked link to redirect, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := visit("/secret+", cookies[0], "text/html"); w.Code != http.StatusOK {
+		t.Errorf("Expected the unlocked link's preview to be shown, got %d", w.Code)
+	}
+
+	tampered := *cookies[0]
+	tampered.Value = "9999999999." + strings.SplitN(tampered.Value, ".", 2)[1]
+	if w := redirect(&tampered, "application/json"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a tampered cookie to be rejected, got %d", w.Code)
+	}
+}
+
+func TestUnlockRateLimit_PerLink(t *testing.T) {
+	limiter := NewRateLimiter(2, WithRequestKey(UnlockShortCode))
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	attempt := func(path, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", remoteAddr)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Guesses from different addresses share the link's budget
+	for i, remoteAddr := range []string{"203.0.113.1:1234", "203.0.113.2:1234"} {
+		if code := attempt("/api/v1/unlock/secret", remoteAddr); code != http.StatusOK {
+			t.Fatalf("Attempt %d: expected status 200, got %d", i+1, code)
+		}
+	}
+	if code := attempt("/api/v1/unlock/secret", "203.0.113.3:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected guesses from a new address to be limited, got %d", code)
+	}
+	if code := attempt("/api/v1/unlock/other", "203.0.113.3:1234"); code != http.StatusOK {
+		t.Errorf("Expected other links to keep their own budget, got %d", code)
+	}
+}
@@ -2,12 +2,28 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"url-shortener/internal/domain"
 	"url-shortener/internal/service"
 )
 
+// urlsPathPrefix is the path prefix of the single-URL management endpoints
+const urlsPathPrefix = "/api/v1/urls/"
+
+// variantCookieName is the cookie remembering the A/B variant a visitor was
+// assigned. Like the unlock cookie, each link has its own.
+const variantCookieName = "link_variant"
+
+// variantCookieMaxAge is how long a visitor keeps their A/B variant
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
 // URLHandler handles HTTP requests for URL operations
 type URLHandler struct {
 	urlService *service.URLService
@@ -21,62 +37,224 @@ func NewURLHandler(urlService *service.URLService) *URLHandler {
 // CreateShortURL handles POST /api/v1/urls
 func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
 		return
 	}
 
 	var req domain.CreateURLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		respondWithError(w, r, domain.Invalid("Invalid request payload"))
 		return
 	}
 
-	// Validate required fields
-	if req.LongURL == "" {
-		respondWithError(w, http.StatusBadRequest, "long_url is required")
+	// Validate required fields (a split link's URL defaults to its first variant)
+	if req.LongURL == "" && len(req.Variants) == 0 {
+		respondWithError(w, r, domain.Invalid("long_url is required"))
 		return
 	}
 
 	// Create short URL
-	resp, err := h.urlService.ShortenURL(r.Context(), &req)
+	resp, err := h.urlService.ShortenURL(r.Context(), &req, userIDFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if resp.Reused {
+		status = http.StatusOK
+	}
+	respondWithJSON(w, status, resp)
+}
+
+// ListURLs handles GET /api/v1/urls?cursor=&limit=&created_after=&created_before=&status=
+// The listing is scoped to the authenticated user's links.
+func (h *URLHandler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseURLFilter(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	page, err := h.urlService.ListURLs(r.Context(), userIDFromContext(r.Context()), filter, r.URL.Query().Get("cursor"))
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// GetURL handles GET /api/v1/urls/{short_code}
+func (h *URLHandler) GetURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
+		return
+	}
+
+	shortCode := shortCodeFromPath(r, urlsPathPrefix)
+	if shortCode == "" {
+		respondWithError(w, r, domain.Invalid("short_code is required"))
+		return
+	}
+
+	urlEntity, err := h.urlService.GetURL(r.Context(), shortCode, userIDFromContext(r.Context()))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, resp)
+	respondWithJSON(w, http.StatusOK, urlEntity)
 }
 
-// RedirectToOriginal handles GET /{short_code}
+// UpdateURL handles PATCH /api/v1/urls/{short_code}
+func (h *URLHandler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
+		return
+	}
+
+	shortCode := shortCodeFromPath(r, urlsPathPrefix)
+	if shortCode == "" {
+		respondWithError(w, r, domain.Invalid("short_code is required"))
+		return
+	}
+
+	var req domain.UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, r, domain.Invalid("Invalid request payload"))
+		return
+	}
+
+	urlEntity, err := h.urlService.UpdateURL(r.Context(), shortCode, userIDFromContext(r.Context()), &req)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, urlEntity)
+}
+
+// DeleteURL handles DELETE /api/v1/urls/{short_code}
+func (h *URLHandler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
+		return
+	}
+
+	shortCode := shortCodeFromPath(r, urlsPathPrefix)
+	if shortCode == "" {
+		respondWithError(w, r, domain.Invalid("short_code is required"))
+		return
+	}
+
+	if err := h.urlService.DeleteURL(r.Context(), shortCode, userIDFromContext(r.Context())); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RedirectToOriginal handles GET /{short_code}[/path] and the preview page GET /{short_code}+
 func (h *URLHandler) RedirectToOriginal(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
 		return
 	}
 
-	// Extract short code from path
-	shortCode := r.URL.Path[1:] // Remove leading "/"
+	// Extract short code from path; anything after it (/{code}/docs/v2) is
+	// passed through to links that forward their path
+	shortCode, suffix, hasSuffix := strings.Cut(r.URL.Path[1:], "/") // Remove leading "/"
+	shortCode, preview := strings.CutSuffix(shortCode, previewSuffix)
 	if shortCode == "" || shortCode == "api" {
-		http.Error(w, "Not found", http.StatusNotFound)
+		respondWithError(w, r, domain.ErrNotFound)
 		return
 	}
 
-	// Get original URL
-	originalURL, err := h.urlService.GetOriginalURL(r.Context(), shortCode)
-	if err != nil {
-		// Redirect to frontend error page
-		http.Redirect(w, r, "/not-found", http.StatusSeeOther)
+	visit := &domain.Visit{
+		Referrer:       r.Referer(),
+		UserAgent:      r.UserAgent(),
+		ClientIP:       getClientIP(r),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.RawQuery,
+	}
+	if hasSuffix {
+		visit.Path = "/" + suffix
+	}
+	visit.UnlockToken = linkCookie(r, unlockCookieName, shortCode)
+	visit.Variant = linkCookie(r, variantCookieName, shortCode)
+
+	// Get original URL; previews show it without counting a click
+	var dest *domain.Destination
+	var err error
+	if preview {
+		dest, err = h.urlService.PreviewURL(r.Context(), shortCode, visit)
+	} else {
+		dest, err = h.urlService.GetOriginalURL(r.Context(), shortCode, visit)
+	}
+	var appErr *domain.Error
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		respondLinkUnavailable(w, http.StatusNotFound, "/not-found", "Link not found")
+		return
+	case errors.Is(err, domain.ErrExpired):
+		respondLinkUnavailable(w, http.StatusGone, "/expired", "Link expired")
+		return
+	case errors.Is(err, domain.ErrDisabled):
+		respondLinkUnavailable(w, http.StatusGone, "/disabled", "Link disabled")
+		return
+	case errors.Is(err, domain.ErrClickLimitReached):
+		respondLinkUnavailable(w, http.StatusGone, "/used-up", "Link used up")
+		return
+	case errors.As(err, &appErr) && appErr.Code == domain.CodeNotYetActive:
+		setRetryAfter(w, appErr.RetryAfter)
+		respondLinkUnavailable(w, appErr.Status, "/not-active", "Link not active yet")
+		return
+	case errors.Is(err, domain.ErrPasswordRequired):
+		respondPasswordRequired(w, r, shortCode)
+		return
+	case err != nil:
+		respondWithError(w, r, err)
+		return
+	}
+
+	if preview {
+		respondPreview(w, r, dest, false)
 		return
 	}
 
-	// Redirect with 302 (temporary) to track analytics
-	http.Redirect(w, r, originalURL, http.StatusFound)
+	// Keep the visitor on their A/B variant
+	if dest.Variant != "" && dest.Variant != visit.Variant {
+		http.SetCookie(w, &http.Cookie{
+			Name:     linkCookieName(variantCookieName, shortCode),
+			Value:    dest.Variant,
+			Path:     "/",
+			MaxAge:   int(variantCookieMaxAge / time.Second),
+			HttpOnly: true,
+			Secure:   isHTTPS(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	// Redirect with the link's status (302 unless configured otherwise, so
+	// browsers keep coming back and every visit is tracked)
+	if dest.Type == domain.RedirectInterstitial {
+		respondPreview(w, r, dest, true)
+		return
+	}
+	http.Redirect(w, r, dest.URL, dest.Type.StatusCode())
 }
 
-// GetAnalytics handles GET /api/v1/analytics/{short_code}
+// GetAnalytics handles GET /api/v1/analytics/{short_code}?from=&to=&interval=
 func (h *URLHandler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondWithError(w, r, domain.ErrMethodNotAllowed)
 		return
 	}
 
@@ -84,23 +262,128 @@ func (h *URLHandler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
 	// Path format: /api/v1/analytics/{short_code}
 	shortCode := r.URL.Path[len("/api/v1/analytics/"):]
 	if shortCode == "" {
-		respondWithError(w, http.StatusBadRequest, "short_code is required")
+		respondWithError(w, r, domain.Invalid("short_code is required"))
+		return
+	}
+
+	query, err := parseAnalyticsQuery(r)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	// Get analytics
-	analytics, err := h.urlService.GetAnalytics(r.Context(), shortCode)
+	analytics, err := h.urlService.GetAnalytics(r.Context(), shortCode, userIDFromContext(r.Context()), query)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Analytics not found")
+		respondWithError(w, r, err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, analytics)
 }
 
-// HealthCheck handles GET /health
-func (h *URLHandler) HealthCheck(w http.ResponseWriter, _ *http.Request) {
-	respondWithJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+// linkCookieName returns the name the cookie name is set under for the link
+// shortCode. Link cookies are keyed by the code rather than scoped to the
+// link's path, so they also reach its preview (/{code}+) and deep links.
+func linkCookieName(name, shortCode string) string {
+	return name + "_" + shortCode
+}
+
+// linkCookie returns the value of the cookie name for the link shortCode, or
+// "". Cookies set before they were keyed by code were scoped to the link's
+// path instead, so those are still honoured where the browser sends them.
+func linkCookie(r *http.Request, name, shortCode string) string {
+	if cookie, err := r.Cookie(linkCookieName(name, shortCode)); err == nil {
+		return cookie.Value
+	}
+	if cookie, err := r.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// shortCodeFromPath extracts the short code following prefix in the request path.
+// It returns an empty string when the remainder is empty or spans several segments.
+func shortCodeFromPath(r *http.Request, prefix string) string {
+	shortCode := strings.TrimPrefix(r.URL.Path, prefix)
+	if shortCode == r.URL.Path || strings.Contains(shortCode, "/") {
+		return ""
+	}
+	return shortCode
+}
+
+// parseURLFilter reads the listing filters and page size from the query string
+func parseURLFilter(r *http.Request) (domain.URLFilter, error) {
+	params := r.URL.Query()
+	filter := domain.URLFilter{
+		Status: domain.URLStatus(params.Get("status")),
+	}
+
+	switch filter.Status {
+	case "", domain.URLStatusActive, domain.URLStatusExpired:
+	default:
+		return filter, domain.Invalid("status must be active or expired")
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return filter, domain.Invalid("limit must be a positive integer")
+		}
+		filter.Limit = n
+	}
+
+	for param, dest := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		t, err := parseTimeParam(params.Get(param))
+		if err != nil {
+			return filter, domain.Invalid(fmt.Sprintf("invalid %s: %v", param, err))
+		}
+		if !t.IsZero() {
+			*dest = &t
+		}
+	}
+
+	return filter, nil
+}
+
+// parseAnalyticsQuery reads the from, to and interval query parameters.
+// Timestamps are RFC 3339 or plain dates (YYYY-MM-DD).
+func parseAnalyticsQuery(r *http.Request) (domain.AnalyticsQuery, error) {
+	params := r.URL.Query()
+	query := domain.AnalyticsQuery{
+		Interval: domain.AnalyticsInterval(params.Get("interval")),
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(params.Get("from")); err != nil {
+		return query, domain.Invalid(fmt.Sprintf("invalid from: %v", err))
+	}
+	if query.To, err = parseTimeParam(params.Get("to")); err != nil {
+		return query, domain.Invalid(fmt.Sprintf("invalid to: %v", err))
+	}
+
+	if err := query.Normalize(time.Now()); err != nil {
+		return query, domain.Invalid(err.Error())
+	}
+	return query, nil
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date; empty yields the zero time
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+	return t, nil
 }
 
 // respondWithJSON sends a JSON response
@@ -117,7 +400,53 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	_, _ = w.Write(response)
 }
 
-// respondWithError sends an error response
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+// respondLinkUnavailable answers a redirect that cannot be served with the given
+// status and a small page sending browsers on to the matching frontend page
+func respondLinkUnavailable(w http.ResponseWriter, code int, page, title string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintf(w,
+		`<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0; url=%s"><title>%s</title></head><body><a href="%s">%s</a></body></html>`,
+		page, title, page, title,
+	)
+}
+
+// setRetryAfter sets the Retry-After header to d, rounded up to whole seconds
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10))
+	}
+}
+
+// errorResponse is the JSON envelope of every error response
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Reason    string `json:"reason,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// respondWithError sends err in the error envelope. Errors that are not a
+// *domain.Error are treated as internal, and the cause of any 5xx is logged
+// rather than sent to the client.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *domain.Error
+	if !errors.As(err, &appErr) {
+		appErr = domain.Internal(err)
+	}
+	if appErr.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+	setRetryAfter(w, appErr.RetryAfter)
+
+	respondWithJSON(w, appErr.Status, errorResponse{Error: errorBody{
+		Code:      appErr.Code,
+		Message:   appErr.Message,
+		Reason:    appErr.Reason,
+		RequestID: requestID(r),
+	}})
 }
@@ -4,33 +4,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func TestHealthCheck(t *testing.T) {
-	handler := &URLHandler{}
-
-	req := httptest.NewRequest(http.MethodGet, "/health", nil)
-	w := httptest.NewRecorder()
-
-	handler.HealthCheck(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
-	}
-
-	var response map[string]string
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
-	}
-
-	if response["status"] != "healthy" {
-		t.Errorf("Expected status 'healthy', got '%s'", response["status"])
-	}
+// newTestHandler returns a handler backed by in-memory storage
+func newTestHandler() (*URLHandler, *repository.MemoryRepository) {
+	store := repository.NewMemoryRepository()
+	svc := service.NewURLService(store, repository.NewMemoryCache(), "http://sho.rt")
+	return NewURLHandler(svc), store
 }
 
 func TestCreateShortURL_InvalidJSON(t *testing.T) {
@@ -84,3 +76,346 @@ func TestGetAnalytics_MissingShortCode(t *testing.T) {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
 }
+
+func TestGetAnalytics_InvalidInterval(t *testing.T) {
+	handler := &URLHandler{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/analytics/abc?interval=month", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetAnalytics(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestGetAnalytics_InvalidRange(t *testing.T) {
+	handler := &URLHandler{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/analytics/abc?from=2024-03-05&to=2024-03-01", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetAnalytics(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestListURLs_InvalidStatus(t *testing.T) {
+	handler := &URLHandler{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls?status=archived", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListURLs(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestGetURL_MissingShortCode(t *testing.T) {
+	handler := &URLHandler{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetURL(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestRespondWithError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{"domain error", domain.ErrAliasTaken, http.StatusConflict, "alias_taken", "custom alias already exists"},
+		{"validation error", domain.Invalid("long_url is required"), http.StatusBadRequest, "invalid_request", "long_url is required"},
+		{"plain error", errors.New("pq: connection refused"), http.StatusInternalServerError, "internal_error", "Internal server error"},
+		{"wrapped internal error", domain.Internal(errors.New("pq: connection refused")), http.StatusInternalServerError, "internal_error", "Internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/urls", nil)
+			req.Header.Set("X-Request-ID", "req-123")
+			w := httptest.NewRecorder()
+
+			respondWithError(w, req, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var response errorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Error.Code != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, response.Error.Code)
+			}
+			if response.Error.Message != tt.wantMessage {
+				t.Errorf("Expected message %q, got %q", tt.wantMessage, response.Error.Message)
+			}
+			if response.Error.RequestID != "req-123" {
+				t.Errorf("Expected request ID %q, got %q", "req-123", response.Error.RequestID)
+			}
+		})
+	}
+}
+
+func TestCreateShortURL_DuplicateAlias(t *testing.T) {
+	handler, _ := newTestHandler()
+
+	create := func() *httptest.ResponseRecorder {
+		body := []byte(`{"long_url": "https://example.com", "custom_alias": "taken"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", bytes.NewBuffer(body))
+		req = req.WithContext(withUserID(req.Context(), "owner"))
+		w := httptest.NewRecorder()
+		handler.CreateShortURL(w, req)
+		return w
+	}
+
+	if w := create(); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+
+	w := create()
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+	var response errorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error.Code != "alias_taken" {
+		t.Errorf("Expected code %q, got %q", "alias_taken", response.Error.Code)
+	}
+}
+
+func TestMethodHandler_NotAllowed(t *testing.T) {
+	handler := MethodHandler{
+		http.MethodGet: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/urls/abc", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+	if w.Header().Get("Allow") != http.MethodGet {
+		t.Errorf("Expected Allow header %q, got %q", http.MethodGet, w.Header().Get("Allow"))
+	}
+}
+
+func TestRedirectToOriginal_Statuses(t *testing.T) {
+	handler, store := newTestHandler()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	used := int64(1)
+	soon := time.Now().Add(time.Hour)
+	for _, u := range []*domain.URL{
+		{ShortCode: "live", OriginalURL: "https://example.com"},
+		{ShortCode: "old", OriginalURL: "https://example.com", ExpiresAt: &past},
+		{ShortCode: "off", OriginalURL: "https://example.com", Disabled: true},
+		{ShortCode: "once", OriginalURL: "https://example.com", MaxClicks: &used, ClicksUsed: 1},
+		{ShortCode: "soon", OriginalURL: "https://example.com", ActivatesAt: &soon},
+	} {
+		if err := store.CreateURL(ctx, u); err != nil {
+			t.Fatalf("CreateURL returned error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantTarget string
+	}{
+		{"/live", http.StatusFound, "https://example.com"},
+		{"/missing", http.StatusNotFound, "/not-found"},
+		{"/old", http.StatusGone, "/expired"},
+		{"/off", http.StatusGone, "/disabled"},
+		{"/once", http.StatusGone, "/used-up"},
+		{"/soon", http.StatusForbidden, "/not-active"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			handler.RedirectToOriginal(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusFound {
+				if w.Header().Get("Location") != tt.wantTarget {
+					t.Errorf("Expected Location %q, got %q", tt.wantTarget, w.Header().Get("Location"))
+				}
+			} else if !bytes.Contains(w.Body.Bytes(), []byte(tt.wantTarget)) {
+				t.Errorf("Expected body to point at %q, got %q", tt.wantTarget, w.Body.String())
+			}
+			if tt.path == "/soon" && w.Header().Get("Retry-After") != "3600" {
+				t.Errorf("Expected Retry-After 3600, got %q", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRedirectToOriginal_VariantCookie(t *testing.T) {
+	handler, store := newTestHandler()
+	variants := []domain.Variant{
+		{Name: "A", TargetURL: "https://example.com/a", Weight: 1},
+		{Name: "B", TargetURL: "https://example.com/b", Weight: 1},
+	}
+	if err := store.CreateURL(context.Background(), &domain.URL{ShortCode: "split", OriginalURL: "https://example.com/a", Variants: variants}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+
+	// A visitor carrying a variant cookie keeps their variant and is not sent a new cookie
+	req := httptest.NewRequest(http.MethodGet, "/split", nil)
+	req.AddCookie(&http.Cookie{Name: "link_variant_split", Value: "B"})
+	w := httptest.NewRecorder()
+	handler.RedirectToOriginal(w, req)
+	if w.Header().Get("Location") != "https://example.com/b" {
+		t.Errorf("Expected the cookie's variant, got Location %q", w.Header().Get("Location"))
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected no new cookie, got %v", w.Result().Cookies())
+	}
+
+	// A new visitor is assigned a variant and told to remember it
+	req = httptest.NewRequest(http.MethodGet, "/split", nil)
+	w = httptest.NewRecorder()
+	handler.RedirectToOriginal(w, req)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "link_variant_split" || cookies[0].Path != "/" {
+		t.Fatalf("Expected a variant cookie keyed by the link, got %v", cookies)
+	}
+	want := map[string]string{"A": "https://example.com/a", "B": "https://example.com/b"}[cookies[0].Value]
+	if want == "" || w.Header().Get("Location") != want {
+		t.Errorf("Expected the redirect to match variant %q, got Location %q", cookies[0].Value, w.Header().Get("Location"))
+	}
+
+	// The preview shows the visitor's variant too, and cookies scoped to the
+	// link's path before they were keyed by code are still honoured
+	for _, tt := range []struct {
+		path   string
+		cookie *http.Cookie
+	}{
+		{"/split+", &http.Cookie{Name: "link_variant_split", Value: "B"}},
+		{"/split", &http.Cookie{Name: variantCookieName, Value: "B"}},
+	} {
+		req = httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.AddCookie(tt.cookie)
+		w = httptest.NewRecorder()
+		handler.RedirectToOriginal(w, req)
+		if w.Header().Get("Location") != "https://example.com/b" && !strings.Contains(w.Body.String(), "https://example.com/b") {
+			t.Errorf("%s: expected variant B, got %d %q", tt.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRedirectToOriginal_ForwardsPath(t *testing.T) {
+	handler, store := newTestHandler()
+	links := []*domain.URL{
+		{ShortCode: "docs", OriginalURL: "https://example.com/docs", ForwardPath: true, ForwardQuery: true},
+		{ShortCode: "plain", OriginalURL: "https://example.com/page"},
+	}
+	for _, link := range links {
+		if err := store.CreateURL(context.Background(), link); err != nil {
+			t.Fatalf("CreateURL returned error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path, location string
+		status         int
+	}{
+		{"/docs/api/v2?x=1", "https://example.com/docs/api/v2?x=1", http.StatusFound},
+		{"/docs", "https://example.com/docs", http.StatusFound},
+		{"/plain/api", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.RedirectToOriginal(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: expected %d to %q, got %d to %q", tt.path, tt.status, tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRedirectToOriginal_RedirectTypes(t *testing.T) {
+	handler, store := newTestHandler()
+
+	create := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/urls", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler.CreateShortURL(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 for %s, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+	create(`{"long_url": "https://example.com/a", "custom_alias": "moved", "redirect_type": 301}`)
+	create(`{"long_url": "https://example.com/b", "custom_alias": "perm", "redirect_type": "308"}`)
+	create(`{"long_url": "https://example.com/c", "custom_alias": "temp", "redirect_type": 307}`)
+	create(`{"long_url": "https://example.com/d", "custom_alias": "plain"}`)
+	create(`{"long_url": "https://example.com/e?x=1&y=<b>", "custom_alias": "warn", "redirect_type": "interstitial", "title": "Spring <Sale>"}`)
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/moved", http.StatusMovedPermanently, "https://example.com/a"},
+		{"/perm", http.StatusPermanentRedirect, "https://example.com/b"},
+		{"/temp", http.StatusTemporaryRedirect, "https://example.com/c"},
+		{"/plain", http.StatusFound, "https://example.com/d"},
+		{"/warn", http.StatusOK, ""},
+		{"/plain+", http.StatusOK, ""},
+		{"/missing+", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.RedirectToOriginal(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: expected %d to %q, got %d to %q", tt.path, tt.status, tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// The interstitial shows the escaped destination and title with a button to continue
+	w := httptest.NewRecorder()
+	handler.RedirectToOriginal(w, httptest.NewRequest(http.MethodGet, "/warn", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"<title>Spring &lt;Sale&gt;</title>",
+		`href="https://example.com/e?x=1&amp;y=%3cb%3e"`,
+		"example.com",
+		"Continue",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the interstitial to contain %q, got %s", want, body)
+		}
+	}
+
+	// Previews are not counted as clicks
+	stored, _ := store.GetURLByShortCode(context.Background(), "plain")
+	if stored.ClickCount != 1 {
+		t.Errorf("Expected only the redirect to be counted, got %d clicks", stored.ClickCount)
+	}
+}
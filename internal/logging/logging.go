@@ -0,0 +1,93 @@
+// Package logging configures the structured JSON logger and carries the
+// request-scoped attributes (request ID, short code, trace) that every log
+// record made with a request's context is annotated with.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys added from the context
+const (
+	RequestIDKey = "request_id"
+	ShortCodeKey = "short_code"
+	TraceIDKey   = "trace_id"
+	SpanIDKey    = "span_id"
+)
+
+type contextKey int
+
+const (
+	requestIDContextKey contextKey = iota
+	shortCodeContextKey
+)
+
+// New returns a logger writing JSON records of at least level to w. Records
+// logged with a context carry its request ID, short code and trace.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(&contextHandler{Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// ParseLevel parses a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: want debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// WithShortCode returns a copy of ctx carrying the short code a request is about
+func WithShortCode(ctx context.Context, shortCode string) context.Context {
+	return context.WithValue(ctx, shortCodeContextKey, shortCode)
+}
+
+// ShortCode returns the short code carried by ctx, or ""
+func ShortCode(ctx context.Context) string {
+	code, _ := ctx.Value(shortCodeContextKey).(string)
+	return code
+}
+
+// contextHandler adds the request ID, short code and trace of a record's
+// context to it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	if code := ShortCode(ctx); code != "" {
+		record.AddAttrs(slog.String(ShortCodeKey, code))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(slog.String(TraceIDKey, sc.TraceID().String()), slog.String(SpanIDKey, sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
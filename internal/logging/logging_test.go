@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew_ContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	ctx := WithShortCode(WithRequestID(context.Background(), "req-1"), "abc")
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa},
+	}))
+	logger.DebugContext(ctx, "hidden")
+	logger.InfoContext(ctx, "cache populated", "ttl", "1h")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected exactly one JSON record, got %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{
+		"level": "INFO", "msg": "cache populated", "ttl": "1h", RequestIDKey: "req-1", ShortCodeKey: "abc",
+		TraceIDKey: "4bf92f35000000000000000000000000", SpanIDKey: "00f067aa00000000",
+	} {
+		if record[key] != want {
+			t.Errorf("Expected %s %q, got %v", key, want, record[key])
+		}
+	}
+
+	buf.Reset()
+	logger.Info("no context")
+	record = nil
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if _, ok := record[RequestIDKey]; ok {
+		t.Errorf("Expected no request ID without a context, got %v", record)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		if level, err := ParseLevel(name); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", name, level, err, want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+}
@@ -0,0 +1,165 @@
+// Package metrics collects the Prometheus metrics of the server.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of the server's own metrics
+const namespace = "shortener"
+
+// Metrics records the server's metrics in its own registry. The recording
+// methods are safe to call on a nil *Metrics, which records nothing, so
+// components work unchanged without metrics (e.g. in tests).
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	cacheLookups    *prometheus.CounterVec
+	linksCreated    prometheus.Counter
+	linksReaped     prometheus.Counter
+	rateLimited     *prometheus.CounterVec
+	clickFlushLag   prometheus.Histogram
+}
+
+// New creates the server's metrics, along with the Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Redirect cache lookups by result (hit or miss).",
+		}, []string{"result"}),
+		linksCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "links_created_total",
+			Help:      "Short links created (reused links are not counted).",
+		}),
+		linksReaped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "links_reaped_total",
+			Help:      "Expired links deleted by the expiry reaper.",
+		}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests rejected by a rate limiter, by limiter.",
+		}, []string{"limiter"}),
+		clickFlushLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "click_flush_lag_seconds",
+			Help:      "Age of the oldest click event written by each click flush.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 11),
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.cacheLookups,
+		m.linksCreated,
+		m.linksReaped,
+		m.rateLimited,
+		m.clickFlushLag,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exports the connection pool stats of db (sql.DB.Stats) under
+// the name dbName
+func (m *Metrics) RegisterDB(db *sql.DB, dbName string) error {
+	if m == nil {
+		return nil
+	}
+	return m.registry.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// knownMethods are the HTTP methods recorded as is; others are recorded as
+// "OTHER" so clients cannot create arbitrarily many series
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// ObserveRequest records a served HTTP request. route must be of bounded
+// cardinality, such as the pattern the request was routed by.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+	m.requests.With(labels).Inc()
+	m.requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// CacheHit records a redirect served from the cache
+func (m *Metrics) CacheHit() {
+	if m != nil {
+		m.cacheLookups.WithLabelValues("hit").Inc()
+	}
+}
+
+// CacheMiss records a redirect that had to be looked up in the store
+func (m *Metrics) CacheMiss() {
+	if m != nil {
+		m.cacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// LinksCreated records n newly created links
+func (m *Metrics) LinksCreated(n int) {
+	if m != nil && n > 0 {
+		m.linksCreated.Add(float64(n))
+	}
+}
+
+// LinksReaped records n expired links deleted by the expiry reaper
+func (m *Metrics) LinksReaped(n int) {
+	if m != nil && n > 0 {
+		m.linksReaped.Add(float64(n))
+	}
+}
+
+// RateLimited records a request rejected by the named rate limiter
+func (m *Metrics) RateLimited(limiter string) {
+	if m != nil {
+		m.rateLimited.WithLabelValues(limiter).Inc()
+	}
+}
+
+// ClickFlush records how long the oldest click of a flush waited to be written
+func (m *Metrics) ClickFlush(lag time.Duration) {
+	if m != nil {
+		m.clickFlushLag.Observe(lag.Seconds())
+	}
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics as served to Prometheus
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.ObserveRequest("/", http.MethodGet, http.StatusFound, 20*time.Millisecond)
+	m.ObserveRequest("/", "BREW", http.StatusMethodNotAllowed, time.Millisecond)
+	m.CacheHit()
+	m.CacheHit()
+	m.CacheMiss()
+	m.LinksCreated(3)
+	m.LinksReaped(4)
+	m.RateLimited("create")
+	m.ClickFlush(2 * time.Second)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`shortener_http_requests_total{method="GET",route="/",status="302"} 1`,
+		`shortener_http_requests_total{method="OTHER",route="/",status="405"} 1`,
+		`shortener_http_request_duration_seconds_count{method="GET",route="/",status="302"} 1`,
+		`shortener_cache_lookups_total{result="hit"} 2`,
+		`shortener_cache_lookups_total{result="miss"} 1`,
+		`shortener_links_created_total 3`,
+		`shortener_links_reaped_total 4`,
+		`shortener_rate_limited_requests_total{limiter="create"} 1`,
+		`shortener_click_flush_lag_seconds_sum 2`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the metrics to contain %q", want)
+		}
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("/", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.CacheHit()
+	m.CacheMiss()
+	m.LinksCreated(1)
+	m.LinksReaped(1)
+	m.RateLimited("create")
+	m.ClickFlush(time.Second)
+	if err := m.RegisterDB(nil, "db"); err != nil {
+		t.Errorf("RegisterDB returned error: %v", err)
+	}
+}
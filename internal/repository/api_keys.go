@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"url-shortener/internal/domain"
+)
+
+// CreateAPIKey stores a new API key under the hash of its raw value
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key *domain.APIKey, keyHash string) error {
+	ctx, span := r.startSpan(ctx, "CreateAPIKey")
+	defer span.End()
+
+	query := `
+		INSERT INTO api_keys (key_hash, user_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, keyHash, key.UserID, key.Name).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserIDByAPIKeyHash resolves a non-revoked API key hash to its user ID
+func (r *PostgresRepository) GetUserIDByAPIKeyHash(ctx context.Context, keyHash string) (string, error) {
+	ctx, span := r.startSpan(ctx, "GetUserIDByAPIKeyHash")
+	defer span.End()
+
+	query := `SELECT user_id FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+
+	var userID string
+	err := r.db.QueryRowContext(ctx, query, keyHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", domain.ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,541 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"url-shortener/internal/domain"
+)
+
+// MemoryRepository is an in-memory URLStore, intended for tests and local development
+type MemoryRepository struct {
+	mu          sync.RWMutex
+	urls        map[string]*domain.URL
+	events      []domain.ClickEvent
+	archived    []domain.ClickEvent
+	apiKeys     map[string]domain.APIKey
+	nextID      int64
+	nextEventID int64
+	nextKeyID   int64
+	locks       sync.Map
+}
+
+// NewMemoryRepository creates a new in-memory URL store
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		urls:    make(map[string]*domain.URL),
+		apiKeys: make(map[string]domain.APIKey),
+	}
+}
+
+// CreateURL stores a new URL
+func (r *MemoryRepository) CreateURL(_ context.Context, url *domain.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.urls[url.ShortCode]; exists {
+		return fmt.Errorf("failed to create URL: short code %q already exists", url.ShortCode)
+	}
+
+	if url.ID == 0 {
+		r.nextID++
+		url.ID = r.nextID
+	}
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+
+	stored := *url
+	r.urls[url.ShortCode] = &stored
+	return nil
+}
+
+// CreateURLs stores several URLs atomically: if any short code is taken, none are stored
+func (r *MemoryRepository) CreateURLs(_ context.Context, urls []*domain.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		if _, exists := r.urls[url.ShortCode]; exists || seen[url.ShortCode] {
+			return fmt.Errorf("failed to create URLs: short code %q already exists", url.ShortCode)
+		}
+		seen[url.ShortCode] = true
+	}
+
+	for _, url := range urls {
+		r.nextID++
+		url.ID = r.nextID
+		if url.CreatedAt.IsZero() {
+			url.CreatedAt = time.Now()
+		}
+
+		stored := *url
+		r.urls[url.ShortCode] = &stored
+	}
+	return nil
+}
+
+// GetURLByShortCode retrieves a URL by its short code, whether or not it has expired
+func (r *MemoryRepository) GetURLByShortCode(_ context.Context, shortCode string) (*domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+
+	found := *url
+	return &found, nil
+}
+
+// UpdateURL saves the destination, activation window, redirect rules, A/B
+// variants, forwarding, redirect type, title and disabled flag of an existing URL
+func (r *MemoryRepository) UpdateURL(_ context.Context, url *domain.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.urls[url.ShortCode]
+	if !ok {
+		return domain.ErrNotFound
+	}
+
+	stored.OriginalURL = url.OriginalURL
+	stored.CanonicalURL = url.CanonicalURL
+	stored.ActivatesAt = url.ActivatesAt
+	stored.ExpiresAt = url.ExpiresAt
+	stored.Disabled = url.Disabled
+	stored.Rules = url.Rules
+	stored.Variants = url.Variants
+	stored.ForwardPath = url.ForwardPath
+	stored.ForwardQuery = url.ForwardQuery
+	stored.RedirectType = url.RedirectType
+	stored.Title = url.Title
+	return nil
+}
+
+// DeleteURL removes a URL by its short code
+func (r *MemoryRepository) DeleteURL(_ context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.urls[shortCode]; !ok {
+		return domain.ErrNotFound
+	}
+
+	delete(r.urls, shortCode)
+	r.archiveEvents(map[string]bool{shortCode: true})
+	return nil
+}
+
+// ListURLs retrieves a page of URLs matching the filter, newest first
+func (r *MemoryRepository) ListURLs(_ context.Context, filter domain.URLFilter) ([]*domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	urls := []*domain.URL{}
+	for _, url := range r.urls {
+		switch {
+		case filter.OwnerID != "" && (url.UserID == nil || *url.UserID != filter.OwnerID),
+			filter.CreatedAfter != nil && url.CreatedAt.Before(*filter.CreatedAfter),
+			filter.CreatedBefore != nil && !url.CreatedAt.Before(*filter.CreatedBefore),
+			filter.BeforeID > 0 && url.ID >= filter.BeforeID,
+			filter.Status == domain.URLStatusActive && url.IsExpired(now),
+			filter.Status == domain.URLStatusExpired && !url.IsExpired(now):
+			continue
+		}
+		found := *url
+		urls = append(urls, &found)
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID > urls[j].ID })
+	if filter.Limit > 0 && len(urls) > filter.Limit {
+		urls = urls[:filter.Limit]
+	}
+
+	return urls, nil
+}
+
+// CheckShortCodeExists checks if a short code already exists
+func (r *MemoryRepository) CheckShortCodeExists(_ context.Context, shortCode string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.urls[shortCode]
+	return ok, nil
+}
+
+// IncrementClickCount increments the click count for a URL
+func (r *MemoryRepository) IncrementClickCount(_ context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	url.ClickCount++
+	url.LastAccessed = &now
+	return nil
+}
+
+// ConsumeClick uses up one click of a click-limited URL and returns how many
+// are left; ok is false if none were left
+func (r *MemoryRepository) ConsumeClick(_ context.Context, shortCode string) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok || url.MaxClicks == nil || url.ClicksUsed >= *url.MaxClicks {
+		return 0, false, nil
+	}
+	url.ClicksUsed++
+	return *url.MaxClicks - url.ClicksUsed, true, nil
+}
+
+// GetAnalytics retrieves analytics data for a short code
+func (r *MemoryRepository) GetAnalytics(_ context.Context, shortCode string) (*domain.Analytics, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+
+	return &domain.Analytics{
+		ShortCode:    url.ShortCode,
+		ClickCount:   url.ClickCount,
+		LastAccessed: url.LastAccessed,
+	}, nil
+}
+
+// GetNextIDs reserves the next n available IDs
+func (r *MemoryRepository) GetNextIDs(_ context.Context, n int) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, n)
+	for i := range ids {
+		r.nextID++
+		ids[i] = r.nextID
+	}
+	return ids, nil
+}
+
+// FindExistingShortCodes returns those of shortCodes that are already in use
+func (r *MemoryRepository) FindExistingShortCodes(_ context.Context, shortCodes []string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var existing []string
+	for _, shortCode := range shortCodes {
+		if _, ok := r.urls[shortCode]; ok {
+			existing = append(existing, shortCode)
+		}
+	}
+	return existing, nil
+}
+
+// FindURLsByCanonicalURL returns the owner's newest currently active URL without
+// expiry, password, click limit, redirect rules, variants, forwarding, title or
+// non-default redirect type for each of canonicalURLs that they have already
+// shortened, keyed by canonical URL
+func (r *MemoryRepository) FindURLsByCanonicalURL(_ context.Context, ownerID string, canonicalURLs []string) (map[string]*domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(canonicalURLs))
+	for _, canonicalURL := range canonicalURLs {
+		wanted[canonicalURL] = true
+	}
+
+	now := time.Now()
+	found := make(map[string]*domain.URL)
+	for _, url := range r.urls {
+		if !wanted[url.CanonicalURL] || url.UserID == nil || *url.UserID != ownerID || url.Disabled ||
+			url.IsProtected() || url.IsClickLimited() || len(url.Rules) > 0 || len(url.Variants) > 0 ||
+			url.ForwardPath || url.ForwardQuery || url.Title != "" ||
+			url.RedirectType != domain.RedirectFound || url.IsPending(now) || url.ExpiresAt != nil {
+			continue
+		}
+		if prev, ok := found[url.CanonicalURL]; !ok || url.ID > prev.ID {
+			match := *url
+			found[url.CanonicalURL] = &match
+		}
+	}
+	return found, nil
+}
+
+// IncrementClickCounts applies a batch of aggregated click counts
+func (r *MemoryRepository) IncrementClickCounts(_ context.Context, deltas []domain.ClickDelta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, delta := range deltas {
+		url, ok := r.urls[delta.ShortCode]
+		if !ok {
+			continue
+		}
+		url.ClickCount += delta.Clicks
+		if url.LastAccessed == nil || delta.LastAccessed.After(*url.LastAccessed) {
+			lastAccessed := delta.LastAccessed
+			url.LastAccessed = &lastAccessed
+		}
+	}
+	return nil
+}
+
+// RecordClickEvents appends a batch of click events to the event log
+func (r *MemoryRepository) RecordClickEvents(_ context.Context, events []*domain.ClickEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		r.nextEventID++
+		event.ID = r.nextEventID
+		r.events = append(r.events, *event)
+	}
+	return nil
+}
+
+// GetClickTimeSeries counts click events per bucket within the query range.
+// Buckets without clicks are omitted.
+func (r *MemoryRepository) GetClickTimeSeries(_ context.Context, shortCode string, q domain.AnalyticsQuery) ([]domain.TimeSeriesPoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[time.Time]int64)
+	for _, event := range r.events {
+		if event.ShortCode != shortCode || event.OccurredAt.Before(q.From) || !event.OccurredAt.Before(q.To) {
+			continue
+		}
+		counts[q.Interval.Truncate(event.OccurredAt)]++
+	}
+
+	points := make([]domain.TimeSeriesPoint, 0, len(counts))
+	for bucket, clicks := range counts {
+		points = append(points, domain.TimeSeriesPoint{Timestamp: bucket, Clicks: clicks})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+
+	return points, nil
+}
+
+// CountClicksByVariant counts click events within the query range per A/B
+// variant. Clicks not assigned to a variant are not counted.
+func (r *MemoryRepository) CountClicksByVariant(_ context.Context, shortCode string, q domain.AnalyticsQuery) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, event := range r.events {
+		if event.ShortCode != shortCode || event.Variant == "" || event.OccurredAt.Before(q.From) || !event.OccurredAt.Before(q.To) {
+			continue
+		}
+		counts[event.Variant]++
+	}
+	return counts, nil
+}
+
+// DeleteExpiredURLs removes up to limit URLs that expired before expiredBefore
+// and returns their short codes. Their click events are archived.
+func (r *MemoryRepository) DeleteExpiredURLs(_ context.Context, expiredBefore time.Time, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := make(map[string]bool)
+	for shortCode, url := range r.urls {
+		if len(deleted) >= limit {
+			break
+		}
+		if url.ExpiresAt != nil && url.ExpiresAt.Before(expiredBefore) {
+			deleted[shortCode] = true
+			delete(r.urls, shortCode)
+		}
+	}
+
+	r.archiveEvents(deleted)
+
+	shortCodes := make([]string, 0, len(deleted))
+	for shortCode := range deleted {
+		shortCodes = append(shortCodes, shortCode)
+	}
+	sort.Strings(shortCodes)
+	return shortCodes, nil
+}
+
+// archiveEvents moves the click events of the short codes in deleted to the
+// archive. The caller must hold the write lock.
+func (r *MemoryRepository) archiveEvents(deleted map[string]bool) {
+	events := r.events[:0]
+	for _, event := range r.events {
+		if deleted[event.ShortCode] {
+			r.archived = append(r.archived, event)
+		} else {
+			events = append(events, event)
+		}
+	}
+	r.events = events
+}
+
+// WithTryAdvisoryLock runs fn only if lockID is not already held, and reports whether it ran
+func (r *MemoryRepository) WithTryAdvisoryLock(ctx context.Context, lockID int64, fn func(ctx context.Context) error) (bool, error) {
+	if _, held := r.locks.LoadOrStore(lockID, struct{}{}); held {
+		return false, nil
+	}
+	defer r.locks.Delete(lockID)
+
+	return true, fn(ctx)
+}
+
+// CreateAPIKey stores a new API key under the hash of its raw value
+func (r *MemoryRepository) CreateAPIKey(_ context.Context, key *domain.APIKey, keyHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.apiKeys[keyHash]; exists {
+		return fmt.Errorf("failed to create API key: duplicate key")
+	}
+
+	r.nextKeyID++
+	key.ID = r.nextKeyID
+	key.CreatedAt = time.Now()
+	r.apiKeys[keyHash] = *key
+	return nil
+}
+
+// GetUserIDByAPIKeyHash resolves a non-revoked API key hash to its user ID
+func (r *MemoryRepository) GetUserIDByAPIKeyHash(_ context.Context, keyHash string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.apiKeys[keyHash]
+	if !ok || key.RevokedAt != nil {
+		return "", domain.ErrNotFound
+	}
+	return key.UserID, nil
+}
+
+// MemoryCache is an in-memory URLCache and IdempotencyStore, intended for tests
+// and local development
+type MemoryCache struct {
+	mu          sync.RWMutex
+	entries     map[string]memoryCacheEntry
+	idempotency map[string]memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+type memoryCacheEntry struct {
+	redirect  domain.Redirect
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a new in-memory URL cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries:     make(map[string]memoryCacheEntry),
+		idempotency: make(map[string]memoryIdempotencyEntry),
+	}
+}
+
+// Set caches a redirect with TTL
+func (c *MemoryCache) Set(_ context.Context, shortCode string, redirect *domain.Redirect, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := memoryCacheEntry{redirect: *redirect}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	c.entries[shortCode] = entry
+	return nil
+}
+
+// SetMany caches several redirects, each with its own TTL
+func (c *MemoryCache) SetMany(ctx context.Context, entries []CacheEntry) error {
+	for _, entry := range entries {
+		if err := c.Set(ctx, entry.ShortCode, entry.Redirect, entry.TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get retrieves a redirect from cache
+func (c *MemoryCache) Get(_ context.Context, shortCode string) (*domain.Redirect, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[shortCode]
+	if !ok || entry.expired() {
+		return nil, fmt.Errorf("cache miss")
+	}
+	redirect := entry.redirect
+	return &redirect, nil
+}
+
+// Delete removes a URL from cache
+func (c *MemoryCache) Delete(_ context.Context, shortCode string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, shortCode)
+	return nil
+}
+
+// Exists checks if a key exists in cache
+func (c *MemoryCache) Exists(_ context.Context, shortCode string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[shortCode]
+	return ok && !entry.expired(), nil
+}
+
+// ReserveIdempotencyKey stores record under key unless the key is already in use
+func (c *MemoryCache) ReserveIdempotencyKey(_ context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.idempotency[key]; ok && time.Now().Before(entry.expiresAt) {
+		existing := entry.record
+		return &existing, false, nil
+	}
+
+	c.idempotency[key] = memoryIdempotencyEntry{record: *record, expiresAt: time.Now().Add(ttl)}
+	return nil, true, nil
+}
+
+// SaveIdempotencyRecord stores record under key, replacing any previous record
+func (c *MemoryCache) SaveIdempotencyRecord(_ context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.idempotency[key] = memoryIdempotencyEntry{record: *record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// DeleteIdempotencyKey releases key
+func (c *MemoryCache) DeleteIdempotencyKey(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.idempotency, key)
+	return nil
+}
+
+func (e memoryCacheEntry) expired() bool {
+	return !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt)
+}
@@ -4,15 +4,23 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"url-shortener/internal/domain"
+	"url-shortener/internal/tracing"
 
-	// PostgreSQL driver
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// maxBatchRows bounds the rows per multi-row statement to stay well below
+// PostgreSQL's limit of 65535 bind parameters
+const maxBatchRows = 1000
+
 // PostgresRepository handles database operations for URLs
 type PostgresRepository struct {
 	db *sql.DB
@@ -23,22 +31,52 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
+// startSpan starts the client span of the method named method
+func (r *PostgresRepository) startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "PostgresRepository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationNameKey.String(method)),
+	)
+}
+
 // CreateURL inserts a new URL into the database
 func (r *PostgresRepository) CreateURL(ctx context.Context, url *domain.URL) error {
+	ctx, span := r.startSpan(ctx, "CreateURL")
+	defer span.End()
+
+	if len(url.Rules) > 0 {
+		// The URL and its rules are inserted in one transaction
+		return r.CreateURLs(ctx, []*domain.URL{url})
+	}
+
+	variants, err := encodeVariants(url.Variants)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO urls (short_code, original_url, created_at, expires_at, user_id)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO urls (short_code, original_url, canonical_url, created_at, activates_at, expires_at, user_id, password_hash, max_clicks, variants, forward_path, forward_query, redirect_type, title)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb, $11, $12, $13, $14)
 		RETURNING id, created_at
 	`
 
-	err := r.db.QueryRowContext(
+	err = r.db.QueryRowContext(
 		ctx,
 		query,
 		url.ShortCode,
 		url.OriginalURL,
+		url.CanonicalURL,
 		url.CreatedAt,
+		url.ActivatesAt,
 		url.ExpiresAt,
 		url.UserID,
+		url.PasswordHash,
+		url.MaxClicks,
+		variants,
+		url.ForwardPath,
+		url.ForwardQuery,
+		url.RedirectType,
+		url.Title,
 	).Scan(&url.ID, &url.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create URL: %w", err)
@@ -47,28 +85,190 @@ func (r *PostgresRepository) CreateURL(ctx context.Context, url *domain.URL) err
 	return nil
 }
 
-// GetURLByShortCode retrieves a URL by its short code
-func (r *PostgresRepository) GetURLByShortCode(ctx context.Context, shortCode string) (*domain.URL, error) {
-	query := `
-		SELECT id, short_code, original_url, created_at, expires_at, user_id, click_count, last_accessed
-		FROM urls
-		WHERE short_code = $1 AND (expires_at IS NULL OR expires_at > NOW())
-	`
+// CreateURLs inserts several URLs and their redirect rules in a single
+// transaction, so either all of them are created or none are. IDs and creation
+// times are set on the URLs.
+func (r *PostgresRepository) CreateURLs(ctx context.Context, urls []*domain.URL) error {
+	ctx, span := r.startSpan(ctx, "CreateURLs")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for start := 0; start < len(urls); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(urls))
+		batch := urls[start:end]
+
+		byCode := make(map[string]*domain.URL, len(batch))
+		args := make([]interface{}, 0, len(batch)*14)
+		for _, url := range batch {
+			variants, err := encodeVariants(url.Variants)
+			if err != nil {
+				return err
+			}
+			byCode[url.ShortCode] = url
+			args = append(args, url.ShortCode, url.OriginalURL, url.CanonicalURL, url.CreatedAt,
+				url.ActivatesAt, url.ExpiresAt, url.UserID, url.PasswordHash, url.MaxClicks, variants, url.ForwardPath, url.ForwardQuery,
+				url.RedirectType, url.Title)
+		}
+
+		query := `
+			INSERT INTO urls (short_code, original_url, canonical_url, created_at, activates_at, expires_at, user_id, password_hash, max_clicks, variants, forward_path, forward_query, redirect_type, title)
+			VALUES ` + valuesPlaceholders(len(batch), "", "", "", "", "", "", "", "", "", "::jsonb", "", "", "", "") + `
+			RETURNING short_code, id, created_at`
 
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to create URLs: %w", err)
+		}
+		for rows.Next() {
+			var shortCode string
+			var id int64
+			var createdAt time.Time
+			if err := rows.Scan(&shortCode, &id, &createdAt); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("failed to scan created URL: %w", err)
+			}
+			if url, ok := byCode[shortCode]; ok {
+				url.ID = id
+				url.CreatedAt = createdAt
+			}
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to create URLs: %w", err)
+		}
+	}
+
+	if err := insertRules(ctx, tx, urls); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit URLs: %w", err)
+	}
+	return nil
+}
+
+// ruleRow is a redirect rule to insert, with its URL and position
+type ruleRow struct {
+	urlID    int64
+	position int
+	rule     domain.RedirectRule
+}
+
+// insertRules inserts the redirect rules of urls, which must have their IDs set
+func insertRules(ctx context.Context, tx *sql.Tx, urls []*domain.URL) error {
+	var rows []ruleRow
+	for _, url := range urls {
+		for i, rule := range url.Rules {
+			rows = append(rows, ruleRow{urlID: url.ID, position: i, rule: rule})
+		}
+	}
+
+	for start := 0; start < len(rows); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(rows))
+		batch := rows[start:end]
+
+		args := make([]interface{}, 0, len(batch)*4)
+		for _, row := range batch {
+			conditions, err := json.Marshal(row.rule.Conditions)
+			if err != nil {
+				return fmt.Errorf("failed to encode rule conditions: %w", err)
+			}
+			args = append(args, row.urlID, row.position, row.rule.TargetURL, string(conditions))
+		}
+
+		query := `
+			INSERT INTO redirect_rules (url_id, position, target_url, conditions)
+			VALUES ` + valuesPlaceholders(len(batch), "", "", "", "::jsonb")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to create redirect rules: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeVariants returns the JSON stored for A/B variants, or nil for none
+func encodeVariants(variants []domain.Variant) (interface{}, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode variants: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// urlColumns lists the columns scanned by scanURL, in order. The redirect
+// rules are aggregated into a JSON array (NULL without rules) by a subquery,
+// so URLs are read with their rules in one round trip.
+const urlColumns = `id, short_code, original_url, canonical_url, created_at, activates_at, expires_at, user_id, click_count, last_accessed, disabled, password_hash, max_clicks, clicks_used, variants, forward_path, forward_query, redirect_type, title,
+	(SELECT json_agg(json_build_object('target_url', r.target_url, 'conditions', r.conditions) ORDER BY r.position)
+		FROM redirect_rules r WHERE r.url_id = urls.id) AS rules`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanURL scans a row selected with urlColumns
+func scanURL(row rowScanner) (*domain.URL, error) {
 	url := &domain.URL{}
-	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(
+	var variants, rules []byte
+	err := row.Scan(
 		&url.ID,
 		&url.ShortCode,
 		&url.OriginalURL,
+		&url.CanonicalURL,
 		&url.CreatedAt,
+		&url.ActivatesAt,
 		&url.ExpiresAt,
 		&url.UserID,
 		&url.ClickCount,
 		&url.LastAccessed,
+		&url.Disabled,
+		&url.PasswordHash,
+		&url.MaxClicks,
+		&url.ClicksUsed,
+		&variants,
+		&url.ForwardPath,
+		&url.ForwardQuery,
+		&url.RedirectType,
+		&url.Title,
+		&rules,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if variants != nil {
+		if err := json.Unmarshal(variants, &url.Variants); err != nil {
+			return nil, fmt.Errorf("failed to decode variants: %w", err)
+		}
+	}
+	if rules != nil {
+		if err := json.Unmarshal(rules, &url.Rules); err != nil {
+			return nil, fmt.Errorf("failed to decode redirect rules: %w", err)
+		}
+	}
+	return url, nil
+}
+
+// GetURLByShortCode retrieves a URL by its short code, whether or not it has expired
+func (r *PostgresRepository) GetURLByShortCode(ctx context.Context, shortCode string) (*domain.URL, error) {
+	ctx, span := r.startSpan(ctx, "GetURLByShortCode")
+	defer span.End()
 
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE short_code = $1`
+
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, shortCode))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("URL not found")
+		return nil, domain.ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get URL: %w", err)
@@ -77,8 +277,149 @@ func (r *PostgresRepository) GetURLByShortCode(ctx context.Context, shortCode st
 	return url, nil
 }
 
+// UpdateURL saves the destination, activation window, redirect rules, A/B
+// variants, forwarding, redirect type, title and disabled flag of an existing
+// URL. The rules are replaced in the same transaction.
+func (r *PostgresRepository) UpdateURL(ctx context.Context, url *domain.URL) error {
+	ctx, span := r.startSpan(ctx, "UpdateURL")
+	defer span.End()
+
+	variants, err := encodeVariants(url.Variants)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		UPDATE urls
+		SET original_url = $2, canonical_url = $3, activates_at = $4, expires_at = $5, disabled = $6, variants = $7::jsonb,
+			forward_path = $8, forward_query = $9, redirect_type = $10, title = $11
+		WHERE short_code = $1
+		RETURNING id
+	`
+
+	err = tx.QueryRowContext(ctx, query, url.ShortCode, url.OriginalURL, url.CanonicalURL, url.ActivatesAt, url.ExpiresAt, url.Disabled, variants,
+		url.ForwardPath, url.ForwardQuery, url.RedirectType, url.Title).Scan(&url.ID)
+	if err == sql.ErrNoRows {
+		return domain.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM redirect_rules WHERE url_id = $1`, url.ID); err != nil {
+		return fmt.Errorf("failed to delete redirect rules: %w", err)
+	}
+	if err := insertRules(ctx, tx, []*domain.URL{url}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit URL update: %w", err)
+	}
+	return nil
+}
+
+// DeleteURL removes a URL by its short code. Its click events are moved to
+// click_events_archive, so a later link with the same code starts without them.
+func (r *PostgresRepository) DeleteURL(ctx context.Context, shortCode string) error {
+	ctx, span := r.startSpan(ctx, "DeleteURL")
+	defer span.End()
+
+	query := `
+		WITH deleted AS (
+			DELETE FROM urls WHERE short_code = $1
+			RETURNING short_code
+		), moved_events AS (
+			DELETE FROM click_events c USING deleted d
+			WHERE c.short_code = d.short_code
+			RETURNING c.id, c.short_code, c.occurred_at, c.referrer, c.user_agent, c.ip_hash, c.variant
+		), archived_events AS (
+			INSERT INTO click_events_archive (id, short_code, occurred_at, referrer, user_agent, ip_hash, variant)
+			SELECT id, short_code, occurred_at, referrer, user_agent, ip_hash, variant FROM moved_events
+		)
+		SELECT COUNT(*) FROM deleted
+	`
+
+	var deleted int
+	if err := r.db.QueryRowContext(ctx, query, shortCode).Scan(&deleted); err != nil {
+		return fmt.Errorf("failed to delete URL: %w", err)
+	}
+	if deleted == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// ListURLs retrieves a page of URLs matching the filter, newest first
+func (r *PostgresRepository) ListURLs(ctx context.Context, filter domain.URLFilter) ([]*domain.URL, error) {
+	ctx, span := r.startSpan(ctx, "ListURLs")
+	defer span.End()
+
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.OwnerID != "" {
+		where("user_id = $%d", filter.OwnerID)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.BeforeID > 0 {
+		where("id < $%d", filter.BeforeID)
+	}
+	switch filter.Status {
+	case domain.URLStatusActive:
+		conditions = append(conditions, "(expires_at IS NULL OR expires_at > NOW())")
+	case domain.URLStatusExpired:
+		conditions = append(conditions, "expires_at IS NOT NULL AND expires_at <= NOW()")
+	}
+
+	query := `SELECT ` + urlColumns + ` FROM urls`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list URLs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	urls := []*domain.URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URLs: %w", err)
+	}
+
+	return urls, nil
+}
+
 // CheckShortCodeExists checks if a short code already exists
 func (r *PostgresRepository) CheckShortCodeExists(ctx context.Context, shortCode string) (bool, error) {
+	ctx, span := r.startSpan(ctx, "CheckShortCodeExists")
+	defer span.End()
+
 	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)`
 
 	var exists bool
@@ -92,6 +433,9 @@ func (r *PostgresRepository) CheckShortCodeExists(ctx context.Context, shortCode
 
 // IncrementClickCount increments the click count for a URL
 func (r *PostgresRepository) IncrementClickCount(ctx context.Context, shortCode string) error {
+	ctx, span := r.startSpan(ctx, "IncrementClickCount")
+	defer span.End()
+
 	query := `
 		UPDATE urls
 		SET click_count = click_count + 1, last_accessed = $1
@@ -106,8 +450,36 @@ func (r *PostgresRepository) IncrementClickCount(ctx context.Context, shortCode
 	return nil
 }
 
+// ConsumeClick uses up one click of a click-limited URL and returns how many
+// are left; ok is false if none were left. The conditional update makes
+// concurrent redirects race for the last click safely.
+func (r *PostgresRepository) ConsumeClick(ctx context.Context, shortCode string) (int64, bool, error) {
+	ctx, span := r.startSpan(ctx, "ConsumeClick")
+	defer span.End()
+
+	query := `
+		UPDATE urls
+		SET clicks_used = clicks_used + 1
+		WHERE short_code = $1 AND clicks_used < max_clicks
+		RETURNING max_clicks - clicks_used
+	`
+
+	var remaining int64
+	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(&remaining)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to consume click: %w", err)
+	}
+	return remaining, true, nil
+}
+
 // GetAnalytics retrieves analytics data for a short code
 func (r *PostgresRepository) GetAnalytics(ctx context.Context, shortCode string) (*domain.Analytics, error) {
+	ctx, span := r.startSpan(ctx, "GetAnalytics")
+	defer span.End()
+
 	query := `
 		SELECT short_code, click_count, last_accessed
 		FROM urls
@@ -122,7 +494,7 @@ func (r *PostgresRepository) GetAnalytics(ctx context.Context, shortCode string)
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("URL not found")
+		return nil, domain.ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get analytics: %w", err)
@@ -131,27 +503,310 @@ func (r *PostgresRepository) GetAnalytics(ctx context.Context, shortCode string)
 	return analytics, nil
 }
 
-// DeleteExpiredURLs removes expired URLs from the database
-func (r *PostgresRepository) DeleteExpiredURLs(ctx context.Context) error {
-	query := `DELETE FROM urls WHERE expires_at IS NOT NULL AND expires_at < NOW()`
+// IncrementClickCounts applies a batch of aggregated click counts using
+// multi-row UPDATE statements
+func (r *PostgresRepository) IncrementClickCounts(ctx context.Context, deltas []domain.ClickDelta) error {
+	ctx, span := r.startSpan(ctx, "IncrementClickCounts")
+	defer span.End()
 
-	_, err := r.db.ExecContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("failed to delete expired URLs: %w", err)
+	for start := 0; start < len(deltas); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(deltas))
+		batch := deltas[start:end]
+
+		args := make([]interface{}, 0, len(batch)*3)
+		for _, delta := range batch {
+			args = append(args, delta.ShortCode, delta.Clicks, delta.LastAccessed.UTC())
+		}
+
+		query := `
+			UPDATE urls AS u
+			SET click_count = u.click_count + v.clicks,
+				last_accessed = GREATEST(COALESCE(u.last_accessed, v.last_accessed), v.last_accessed)
+			FROM (VALUES ` + valuesPlaceholders(len(batch), "::text", "::bigint", "::timestamp") + `) AS v(short_code, clicks, last_accessed)
+			WHERE u.short_code = v.short_code
+		`
+
+		if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to increment click counts: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// GetNextID gets the next available ID (for Base62 encoding)
-func (r *PostgresRepository) GetNextID(ctx context.Context) (int64, error) {
-	query := `SELECT nextval('urls_id_seq')`
+// RecordClickEvents inserts a batch of click events using multi-row INSERT statements
+func (r *PostgresRepository) RecordClickEvents(ctx context.Context, events []*domain.ClickEvent) error {
+	ctx, span := r.startSpan(ctx, "RecordClickEvents")
+	defer span.End()
+
+	for start := 0; start < len(events); start += maxBatchRows {
+		end := min(start+maxBatchRows, len(events))
+		batch := events[start:end]
+
+		args := make([]interface{}, 0, len(batch)*6)
+		for _, event := range batch {
+			args = append(args, event.ShortCode, event.OccurredAt.UTC(), event.Referrer, event.UserAgent, event.IPHash, event.Variant)
+		}
+
+		query := `
+			INSERT INTO click_events (short_code, occurred_at, referrer, user_agent, ip_hash, variant)
+			VALUES ` + valuesPlaceholders(len(batch), "", "", "", "", "", "")
+
+		if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to record click events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetClickTimeSeries counts click events per bucket within the query range.
+// Buckets without clicks are omitted.
+func (r *PostgresRepository) GetClickTimeSeries(ctx context.Context, shortCode string, q domain.AnalyticsQuery) ([]domain.TimeSeriesPoint, error) {
+	ctx, span := r.startSpan(ctx, "GetClickTimeSeries")
+	defer span.End()
+
+	query := `
+		SELECT date_trunc($2, occurred_at) AS bucket, COUNT(*)
+		FROM click_events
+		WHERE short_code = $1 AND occurred_at >= $3 AND occurred_at < $4
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, shortCode, string(q.Interval), q.From.UTC(), q.To.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click time series: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var points []domain.TimeSeriesPoint
+	for rows.Next() {
+		var point domain.TimeSeriesPoint
+		if err := rows.Scan(&point.Timestamp, &point.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan click time series: %w", err)
+		}
+		point.Timestamp = point.Timestamp.UTC()
+		points = append(points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read click time series: %w", err)
+	}
+
+	return points, nil
+}
+
+// CountClicksByVariant counts click events within the query range per A/B
+// variant. Clicks not assigned to a variant are not counted.
+func (r *PostgresRepository) CountClicksByVariant(ctx context.Context, shortCode string, q domain.AnalyticsQuery) (map[string]int64, error) {
+	ctx, span := r.startSpan(ctx, "CountClicksByVariant")
+	defer span.End()
+
+	query := `
+		SELECT variant, COUNT(*)
+		FROM click_events
+		WHERE short_code = $1 AND variant <> '' AND occurred_at >= $2 AND occurred_at < $3
+		GROUP BY variant
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, shortCode, q.From.UTC(), q.To.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks by variant: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var variant string
+		var clicks int64
+		if err := rows.Scan(&variant, &clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan variant clicks: %w", err)
+		}
+		counts[variant] = clicks
+	}
+
+	return counts, rows.Err()
+}
+
+// DeleteExpiredURLs removes up to limit URLs that expired before expiredBefore
+// and returns their short codes. Their click events are moved to
+// click_events_archive. Rows locked by concurrent transactions are skipped.
+func (r *PostgresRepository) DeleteExpiredURLs(ctx context.Context, expiredBefore time.Time, limit int) ([]string, error) {
+	ctx, span := r.startSpan(ctx, "DeleteExpiredURLs")
+	defer span.End()
+
+	query := `
+		WITH expired AS (
+			SELECT id FROM urls
+			WHERE expires_at IS NOT NULL AND expires_at < $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), deleted AS (
+			DELETE FROM urls u USING expired e
+			WHERE u.id = e.id
+			RETURNING u.short_code
+		), moved_events AS (
+			DELETE FROM click_events c USING deleted d
+			WHERE c.short_code = d.short_code
+			RETURNING c.id, c.short_code, c.occurred_at, c.referrer, c.user_agent, c.ip_hash, c.variant
+		), archived_events AS (
+			INSERT INTO click_events_archive (id, short_code, occurred_at, referrer, user_agent, ip_hash, variant)
+			SELECT id, short_code, occurred_at, referrer, user_agent, ip_hash, variant FROM moved_events
+		)
+		SELECT short_code FROM deleted
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, expiredBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired URLs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var shortCodes []string
+	for rows.Next() {
+		var shortCode string
+		if err := rows.Scan(&shortCode); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted URL: %w", err)
+		}
+		shortCodes = append(shortCodes, shortCode)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete expired URLs: %w", err)
+	}
+
+	return shortCodes, nil
+}
+
+// WithTryAdvisoryLock runs fn only if the session-level advisory lock lockID can
+// be acquired without waiting, and reports whether it ran. The lock is held on a
+// dedicated connection for the duration of fn.
+func (r *PostgresRepository) WithTryAdvisoryLock(ctx context.Context, lockID int64, fn func(ctx context.Context) error) (bool, error) {
+	ctx, span := r.startSpan(ctx, "WithTryAdvisoryLock")
+	defer span.End()
 
-	var id int64
-	err := r.db.QueryRowContext(ctx, query).Scan(&id)
+	conn, err := r.db.Conn(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get next ID: %w", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockID).Scan(&locked); err != nil {
+		return false, fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+	if !locked {
+		return false, nil
 	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
 
-	return id, nil
+	return true, fn(ctx)
+}
+
+// FindURLsByCanonicalURL returns the owner's newest currently active URL without
+// expiry, password, click limit, redirect rules, variants, forwarding, title or
+// non-default redirect type for each of canonicalURLs that they have already
+// shortened, keyed by canonical URL
+func (r *PostgresRepository) FindURLsByCanonicalURL(ctx context.Context, ownerID string, canonicalURLs []string) (map[string]*domain.URL, error) {
+	ctx, span := r.startSpan(ctx, "FindURLsByCanonicalURL")
+	defer span.End()
+
+	query := `
+		SELECT DISTINCT ON (canonical_url) ` + urlColumns + `
+		FROM urls
+		WHERE canonical_url = ANY($1) AND user_id = $2
+			AND NOT disabled AND password_hash IS NULL AND max_clicks IS NULL AND variants IS NULL
+			AND NOT forward_path AND NOT forward_query AND redirect_type = '302' AND title = ''
+			AND NOT EXISTS (SELECT 1 FROM redirect_rules r WHERE r.url_id = urls.id)
+			AND (activates_at IS NULL OR activates_at <= NOW())
+			AND expires_at IS NULL
+		ORDER BY canonical_url, id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(canonicalURLs), ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find URLs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	found := make(map[string]*domain.URL)
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		found[url.CanonicalURL] = url
+	}
+
+	return found, rows.Err()
+}
+
+// GetNextIDs reserves n IDs from the URL sequence in one round trip
+func (r *PostgresRepository) GetNextIDs(ctx context.Context, n int) ([]int64, error) {
+	ctx, span := r.startSpan(ctx, "GetNextIDs")
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT nextval('urls_id_seq') FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next IDs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	ids := make([]int64, 0, n)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan next ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FindExistingShortCodes returns those of shortCodes that are already in use
+func (r *PostgresRepository) FindExistingShortCodes(ctx context.Context, shortCodes []string) ([]string, error) {
+	ctx, span := r.startSpan(ctx, "FindExistingShortCodes")
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT short_code FROM urls WHERE short_code = ANY($1)`, pq.Array(shortCodes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check short codes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var existing []string
+	for rows.Next() {
+		var shortCode string
+		if err := rows.Scan(&shortCode); err != nil {
+			return nil, fmt.Errorf("failed to scan short code: %w", err)
+		}
+		existing = append(existing, shortCode)
+	}
+
+	return existing, rows.Err()
+}
+
+// valuesPlaceholders builds "($1, $2), ($3, $4)" style placeholder rows for a
+// multi-row VALUES list. Each entry in casts is appended to its column's placeholder.
+func valuesPlaceholders(rows int, casts ...string) string {
+	var b strings.Builder
+	n := 1
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j, cast := range casts {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d%s", n, cast)
+			n++
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
 }
@@ -2,10 +2,17 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"url-shortener/internal/domain"
+	"url-shortener/internal/tracing"
+
 	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // RedisRepository handles caching operations
@@ -18,31 +25,109 @@ func NewRedisRepository(client *redis.Client) *RedisRepository {
 	return &RedisRepository{client: client}
 }
 
-// Set caches a URL mapping with TTL
-func (r *RedisRepository) Set(ctx context.Context, shortCode, originalURL string, ttl time.Duration) error {
-	key := fmt.Sprintf("url:%s", shortCode)
-	err := r.client.Set(ctx, key, originalURL, ttl).Err()
+// startSpan starts the client span of the method named method
+func (r *RedisRepository) startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "RedisRepository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationNameKey.String(method)),
+	)
+}
+
+// Set caches a redirect with TTL
+func (r *RedisRepository) Set(ctx context.Context, shortCode string, redirect *domain.Redirect, ttl time.Duration) error {
+	ctx, span := r.startSpan(ctx, "Set")
+	defer span.End()
+
+	value, err := encodeRedirect(redirect)
 	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("url:%s", shortCode)
+	if err := r.client.Set(ctx, key, value, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to cache URL: %w", err)
 	}
 	return nil
 }
 
-// Get retrieves a URL from cache
-func (r *RedisRepository) Get(ctx context.Context, shortCode string) (string, error) {
+// SetMany caches several redirects in a single pipelined round trip
+func (r *RedisRepository) SetMany(ctx context.Context, entries []CacheEntry) error {
+	ctx, span := r.startSpan(ctx, "SetMany")
+	defer span.End()
+
+	values := make([]string, len(entries))
+	for i, entry := range entries {
+		value, err := encodeRedirect(entry.Redirect)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, entry := range entries {
+			pipe.Set(ctx, fmt.Sprintf("url:%s", entry.ShortCode), values[i], entry.TTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cache URLs: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a redirect from cache
+func (r *RedisRepository) Get(ctx context.Context, shortCode string) (*domain.Redirect, error) {
+	ctx, span := r.startSpan(ctx, "Get")
+	defer span.End()
+
 	key := fmt.Sprintf("url:%s", shortCode)
 	val, err := r.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return "", fmt.Errorf("cache miss")
+		return nil, fmt.Errorf("cache miss")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get from cache: %w", err)
+	}
+	return decodeRedirect(val)
+}
+
+// encodeRedirect stores plain redirects as the URL and all others (with
+// rules, variants, forwarding, a title or another redirect type than 302) as
+// JSON; a URL never starts with "{", so the two cannot be confused
+func encodeRedirect(redirect *domain.Redirect) (string, error) {
+	if isPlainRedirect(redirect) {
+		return redirect.URL, nil
 	}
+	value, err := json.Marshal(redirect)
 	if err != nil {
-		return "", fmt.Errorf("failed to get from cache: %w", err)
+		return "", fmt.Errorf("failed to encode redirect: %w", err)
 	}
-	return val, nil
+	return string(value), nil
+}
+
+// isPlainRedirect reports whether a redirect is fully described by its URL
+func isPlainRedirect(redirect *domain.Redirect) bool {
+	return len(redirect.Rules) == 0 && len(redirect.Variants) == 0 && !redirect.ForwardPath && !redirect.ForwardQuery &&
+		(redirect.Type == "" || redirect.Type == domain.RedirectFound) && redirect.Title == ""
+}
+
+// decodeRedirect reverses encodeRedirect
+func decodeRedirect(value string) (*domain.Redirect, error) {
+	if !strings.HasPrefix(value, "{") {
+		return &domain.Redirect{URL: value}, nil
+	}
+	var redirect domain.Redirect
+	if err := json.Unmarshal([]byte(value), &redirect); err != nil {
+		return nil, fmt.Errorf("failed to decode cached redirect: %w", err)
+	}
+	return &redirect, nil
 }
 
 // Delete removes a URL from cache
 func (r *RedisRepository) Delete(ctx context.Context, shortCode string) error {
+	ctx, span := r.startSpan(ctx, "Delete")
+	defer span.End()
+
 	key := fmt.Sprintf("url:%s", shortCode)
 	err := r.client.Del(ctx, key).Err()
 	if err != nil {
@@ -53,6 +138,9 @@ func (r *RedisRepository) Delete(ctx context.Context, shortCode string) error {
 
 // Exists checks if a key exists in cache
 func (r *RedisRepository) Exists(ctx context.Context, shortCode string) (bool, error) {
+	ctx, span := r.startSpan(ctx, "Exists")
+	defer span.End()
+
 	key := fmt.Sprintf("url:%s", shortCode)
 	count, err := r.client.Exists(ctx, key).Result()
 	if err != nil {
@@ -60,3 +148,61 @@ func (r *RedisRepository) Exists(ctx context.Context, shortCode string) (bool, e
 	}
 	return count > 0, nil
 }
+
+// ReserveIdempotencyKey atomically stores record under key unless the key is
+// already in use, in which case the existing record is returned
+func (r *RedisRepository) ReserveIdempotencyKey(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	ctx, span := r.startSpan(ctx, "ReserveIdempotencyKey")
+	defer span.End()
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	previous, err := r.client.SetArgs(ctx, idempotencyKey(key), value, redis.SetArgs{Mode: "NX", TTL: ttl, Get: true}).Result()
+	if err == redis.Nil {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	var existing IdempotencyRecord
+	if err := json.Unmarshal([]byte(previous), &existing); err != nil {
+		return nil, false, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+	return &existing, false, nil
+}
+
+// SaveIdempotencyRecord stores record under key, replacing any previous record
+func (r *RedisRepository) SaveIdempotencyRecord(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	ctx, span := r.startSpan(ctx, "SaveIdempotencyRecord")
+	defer span.End()
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	if err := r.client.Set(ctx, idempotencyKey(key), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotency record: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey releases key
+func (r *RedisRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	ctx, span := r.startSpan(ctx, "DeleteIdempotencyKey")
+	defer span.End()
+
+	if err := r.client.Del(ctx, idempotencyKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// idempotencyKey returns the Redis key of an idempotency record
+func idempotencyKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"url-shortener/internal/domain"
+)
+
+// URLStore defines the persistence operations required by the URL service
+type URLStore interface {
+	CreateURL(ctx context.Context, url *domain.URL) error
+	CreateURLs(ctx context.Context, urls []*domain.URL) error
+	GetURLByShortCode(ctx context.Context, shortCode string) (*domain.URL, error)
+	UpdateURL(ctx context.Context, url *domain.URL) error
+	DeleteURL(ctx context.Context, shortCode string) error
+	ListURLs(ctx context.Context, filter domain.URLFilter) ([]*domain.URL, error)
+	CheckShortCodeExists(ctx context.Context, shortCode string) (bool, error)
+	IncrementClickCount(ctx context.Context, shortCode string) error
+	ConsumeClick(ctx context.Context, shortCode string) (remaining int64, ok bool, err error)
+	GetAnalytics(ctx context.Context, shortCode string) (*domain.Analytics, error)
+	GetNextIDs(ctx context.Context, n int) ([]int64, error)
+	FindExistingShortCodes(ctx context.Context, shortCodes []string) ([]string, error)
+	FindURLsByCanonicalURL(ctx context.Context, ownerID string, canonicalURLs []string) (map[string]*domain.URL, error)
+	IncrementClickCounts(ctx context.Context, deltas []domain.ClickDelta) error
+	RecordClickEvents(ctx context.Context, events []*domain.ClickEvent) error
+	GetClickTimeSeries(ctx context.Context, shortCode string, query domain.AnalyticsQuery) ([]domain.TimeSeriesPoint, error)
+	CountClicksByVariant(ctx context.Context, shortCode string, query domain.AnalyticsQuery) (map[string]int64, error)
+}
+
+// URLCache defines the caching operations required by the URL service
+type URLCache interface {
+	Set(ctx context.Context, shortCode string, redirect *domain.Redirect, ttl time.Duration) error
+	SetMany(ctx context.Context, entries []CacheEntry) error
+	Get(ctx context.Context, shortCode string) (*domain.Redirect, error)
+	Delete(ctx context.Context, shortCode string) error
+	Exists(ctx context.Context, shortCode string) (bool, error)
+}
+
+// CacheEntry is a redirect to be cached with its own TTL
+type CacheEntry struct {
+	ShortCode string
+	Redirect  *domain.Redirect
+	TTL       time.Duration
+}
+
+// IdempotencyRecord is the stored state of a request made with an Idempotency-Key:
+// pending while the request is being handled, then the response to replay
+type IdempotencyRecord struct {
+	RequestHash string `json:"request_hash"`
+	Pending     bool   `json:"pending,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore defines the operations used to deduplicate retried requests
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores record under key if the key is unused. If it
+	// is already in use, the existing record is returned and reserved is false.
+	ReserveIdempotencyKey(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (existing *IdempotencyRecord, reserved bool, err error)
+	SaveIdempotencyRecord(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+}
+
+// APIKeyStore defines the persistence operations for API keys
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *domain.APIKey, keyHash string) error
+	GetUserIDByAPIKeyHash(ctx context.Context, keyHash string) (string, error)
+}
+
+// ExpiryStore defines the operations used to reap expired URLs
+type ExpiryStore interface {
+	DeleteExpiredURLs(ctx context.Context, expiredBefore time.Time, limit int) ([]string, error)
+	WithTryAdvisoryLock(ctx context.Context, lockID int64, fn func(ctx context.Context) error) (bool, error)
+}
+
+// Compile-time checks that the concrete repositories satisfy the interfaces
+var (
+	_ URLStore    = (*PostgresRepository)(nil)
+	_ URLStore    = (*MemoryRepository)(nil)
+	_ APIKeyStore = (*PostgresRepository)(nil)
+	_ APIKeyStore = (*MemoryRepository)(nil)
+	_ ExpiryStore = (*PostgresRepository)(nil)
+	_ ExpiryStore = (*MemoryRepository)(nil)
+	_ URLCache    = (*RedisRepository)(nil)
+	_ URLCache    = (*MemoryCache)(nil)
+
+	_ IdempotencyStore = (*RedisRepository)(nil)
+	_ IdempotencyStore = (*MemoryCache)(nil)
+)
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/repository"
+)
+
+func TestAuthService_CreateAndAuthenticate(t *testing.T) {
+	auth := NewAuthService(repository.NewMemoryRepository())
+	ctx := context.Background()
+
+	rawKey, key, err := auth.CreateAPIKey(ctx, testOwner, "ci")
+	if err != nil {
+		t.Fatalf("CreateAPIKey returned error: %v", err)
+	}
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		t.Errorf("Expected key to start with %q, got %q", apiKeyPrefix, rawKey)
+	}
+	if key.UserID != testOwner {
+		t.Errorf("Expected user ID %q, got %q", testOwner, key.UserID)
+	}
+
+	userID, err := auth.Authenticate(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("Authenticate returned error: %v", err)
+	}
+	if userID != testOwner {
+		t.Errorf("Expected user ID %q, got %q", testOwner, userID)
+	}
+
+	if _, err := auth.Authenticate(ctx, rawKey+"x"); err == nil {
+		t.Error("Expected unknown key to be rejected")
+	}
+	if _, err := auth.Authenticate(ctx, ""); err == nil {
+		t.Error("Expected empty key to be rejected")
+	}
+}
+
+func TestAuthService_GeneratesUserID(t *testing.T) {
+	auth := NewAuthService(repository.NewMemoryRepository())
+
+	_, key, err := auth.CreateAPIKey(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("CreateAPIKey returned error: %v", err)
+	}
+	if len(key.UserID) != 36 || key.UserID[14] != '4' {
+		t.Errorf("Expected a version 4 UUID, got %q", key.UserID)
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+)
+
+// maxBufferedBatches bounds how many batches worth of click events may pile up
+// while the store is unavailable before new events are dropped
+const maxBufferedBatches = 10
+
+// ClickAggregator buffers clicks in memory and flushes them to the store in
+// batches, so redirects never wait on (or contend for) a row update
+type ClickAggregator struct {
+	store     repository.URLStore
+	interval  time.Duration
+	batchSize int
+	metrics   *metrics.Metrics
+
+	mu      sync.Mutex
+	deltas  map[string]*domain.ClickDelta
+	events  []*domain.ClickEvent
+	dropped int64
+
+	flushMu sync.Mutex
+	trigger chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// ClickAggregatorOption configures optional ClickAggregator behaviour
+type ClickAggregatorOption func(*ClickAggregator)
+
+// WithFlushMetrics records in m how long clicks wait in the buffer before
+// they are written
+func WithFlushMetrics(m *metrics.Metrics) ClickAggregatorOption {
+	return func(a *ClickAggregator) {
+		a.metrics = m
+	}
+}
+
+// NewClickAggregator creates a click aggregator that flushes every interval,
+// or sooner once batchSize click events are pending
+func NewClickAggregator(store repository.URLStore, interval time.Duration, batchSize int, opts ...ClickAggregatorOption) *ClickAggregator {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	a := &ClickAggregator{
+		store:     store,
+		interval:  interval,
+		batchSize: batchSize,
+		deltas:    make(map[string]*domain.ClickDelta),
+		trigger:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Start runs the periodic flush loop in the background
+func (a *ClickAggregator) Start() {
+	go a.run()
+}
+
+// Stop halts the flush loop and performs a final flush so no buffered clicks are lost
+func (a *ClickAggregator) Stop(ctx context.Context) error {
+	close(a.stop)
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return a.Flush(ctx)
+}
+
+// Add buffers a click event and bumps the pending counter of its short code
+func (a *ClickAggregator) Add(event *domain.ClickEvent) {
+	a.mu.Lock()
+	delta, ok := a.deltas[event.ShortCode]
+	if !ok {
+		delta = &domain.ClickDelta{ShortCode: event.ShortCode}
+		a.deltas[event.ShortCode] = delta
+	}
+	delta.Clicks++
+	if event.OccurredAt.After(delta.LastAccessed) {
+		delta.LastAccessed = event.OccurredAt
+	}
+
+	if len(a.events) < a.batchSize*maxBufferedBatches {
+		a.events = append(a.events, event)
+	} else {
+		a.dropped++
+	}
+	full := len(a.events) >= a.batchSize
+	a.mu.Unlock()
+
+	if full {
+		select {
+		case a.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush writes all buffered clicks to the store. Clicks that fail to be written
+// are put back into the buffer and retried on the next flush.
+func (a *ClickAggregator) Flush(ctx context.Context) error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	a.mu.Lock()
+	deltas := make([]domain.ClickDelta, 0, len(a.deltas))
+	for _, delta := range a.deltas {
+		deltas = append(deltas, *delta)
+	}
+	events := a.events
+	dropped := a.dropped
+	a.deltas = make(map[string]*domain.ClickDelta)
+	a.events = nil
+	a.dropped = 0
+	a.mu.Unlock()
+
+	if dropped > 0 {
+		slog.WarnContext(ctx, "Click buffer full, dropped click events", "dropped", dropped)
+	}
+
+	if len(deltas) > 0 {
+		if err := a.store.IncrementClickCounts(ctx, deltas); err != nil {
+			a.requeue(deltas, events)
+			return err
+		}
+	}
+
+	if len(events) > 0 {
+		if err := a.store.RecordClickEvents(ctx, events); err != nil {
+			a.requeue(nil, events)
+			return err
+		}
+		// Events are buffered in order, so the first one waited longest
+		a.metrics.ClickFlush(time.Since(events[0].OccurredAt))
+	}
+
+	return nil
+}
+
+// run flushes on every tick or whenever the buffer fills up, until stopped
+func (a *ClickAggregator) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.trigger:
+		case <-a.stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.interval)
+		if err := a.Flush(ctx); err != nil {
+			slog.Error("Failed to flush clicks", "error", err)
+		}
+		cancel()
+	}
+}
+
+// requeue merges unwritten clicks back into the buffer
+func (a *ClickAggregator) requeue(deltas []domain.ClickDelta, events []*domain.ClickEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, d := range deltas {
+		delta, ok := a.deltas[d.ShortCode]
+		if !ok {
+			delta = &domain.ClickDelta{ShortCode: d.ShortCode}
+			a.deltas[d.ShortCode] = delta
+		}
+		delta.Clicks += d.Clicks
+		if d.LastAccessed.After(delta.LastAccessed) {
+			delta.LastAccessed = d.LastAccessed
+		}
+	}
+
+	room := a.batchSize*maxBufferedBatches - len(a.events)
+	if room < len(events) {
+		a.dropped += int64(len(events) - max(room, 0))
+		events = events[:max(room, 0)]
+	}
+	a.events = append(events, a.events...)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/repository"
+)
+
+func TestClickAggregator_FlushBatchesCounts(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	ctx := context.Background()
+
+	for _, code := range []string{"hot", "cold"} {
+		if err := store.CreateURL(ctx, &domain.URL{ShortCode: code, OriginalURL: "https://example.com"}); err != nil {
+			t.Fatalf("CreateURL returned error: %v", err)
+		}
+	}
+
+	agg := NewClickAggregator(store, time.Hour, 100)
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		agg.Add(&domain.ClickEvent{ShortCode: "hot", OccurredAt: now})
+	}
+	agg.Add(&domain.ClickEvent{ShortCode: "cold", OccurredAt: now})
+
+	// Nothing is written before a flush
+	if analytics, _ := store.GetAnalytics(ctx, "hot"); analytics.ClickCount != 0 {
+		t.Fatalf("Expected no clicks before flush, got %d", analytics.ClickCount)
+	}
+
+	if err := agg.Flush(ctx); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+
+	for code, want := range map[string]int64{"hot": 5, "cold": 1} {
+		analytics, err := store.GetAnalytics(ctx, code)
+		if err != nil {
+			t.Fatalf("GetAnalytics returned error: %v", err)
+		}
+		if analytics.ClickCount != want {
+			t.Errorf("%s: expected %d clicks, got %d", code, want, analytics.ClickCount)
+		}
+	}
+
+	points, err := store.GetClickTimeSeries(ctx, "hot", domain.AnalyticsQuery{
+		From:     now.Add(-time.Hour),
+		To:       now.Add(time.Hour),
+		Interval: domain.IntervalHour,
+	})
+	if err != nil {
+		t.Fatalf("GetClickTimeSeries returned error: %v", err)
+	}
+	var events int64
+	for _, p := range points {
+		events += p.Clicks
+	}
+	if events != 5 {
+		t.Errorf("Expected 5 click events, got %d", events)
+	}
+}
+
+func TestClickAggregator_StopFlushesPendingClicks(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	ctx := context.Background()
+
+	if err := store.CreateURL(ctx, &domain.URL{ShortCode: "bye", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+
+	agg := NewClickAggregator(store, time.Hour, 100)
+	agg.Start()
+	agg.Add(&domain.ClickEvent{ShortCode: "bye", OccurredAt: time.Now().UTC()})
+
+	if err := agg.Stop(ctx); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+
+	analytics, _ := store.GetAnalytics(ctx, "bye")
+	if analytics.ClickCount != 1 {
+		t.Errorf("Expected pending click to be flushed on stop, got %d", analytics.ClickCount)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"url-shortener/internal/domain"
+)
+
+func TestGetOriginalURL_ClickLimit(t *testing.T) {
+	svc, store, cache := newTestService()
+	ctx := context.Background()
+
+	alias, limit := "oneshot", int64(3)
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/download",
+		CustomAlias: &alias,
+		MaxClicks:   &limit,
+	}, ""); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if _, err := cache.Get(ctx, alias); err == nil {
+		t.Error("Expected click-limited links not to be cached")
+	}
+
+	var served, refused atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.GetOriginalURL(ctx, alias, nil)
+			switch {
+			case err == nil:
+				served.Add(1)
+			case errors.Is(err, domain.ErrClickLimitReached):
+				refused.Add(1)
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if served.Load() != limit || refused.Load() != 20-limit {
+		t.Errorf("Expected %d redirects and %d refusals, got %d and %d", limit, 20-limit, served.Load(), refused.Load())
+	}
+
+	stored, err := store.GetURLByShortCode(ctx, alias)
+	if err != nil {
+		t.Fatalf("GetURLByShortCode returned error: %v", err)
+	}
+	if stored.ClicksUsed != limit {
+		t.Errorf("Expected %d clicks used, got %d", limit, stored.ClicksUsed)
+	}
+}
+
+func TestShortenURL_InvalidMaxClicks(t *testing.T) {
+	svc, _, _ := newTestService()
+
+	zero := int64(0)
+	_, err := svc.ShortenURL(context.Background(), &domain.CreateURLRequest{LongURL: "https://example.com", MaxClicks: &zero}, "")
+
+	var appErr *domain.Error
+	if !errors.As(err, &appErr) || appErr.Code != "invalid_request" {
+		t.Errorf("Expected invalid_request, got %v", err)
+	}
+}
+
+func TestPreviewURL_DoesNotConsumeClicks(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+
+	alias, limit := "once", int64(1)
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/download",
+		CustomAlias: &alias,
+		MaxClicks:   &limit,
+	}, ""); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		dest, err := svc.PreviewURL(ctx, alias, nil)
+		if err != nil || dest.URL != "https://example.com/download" {
+			t.Fatalf("PreviewURL returned %+v, %v", dest, err)
+		}
+	}
+	if stored, _ := store.GetURLByShortCode(ctx, alias); stored.ClicksUsed != 0 || stored.ClickCount != 0 {
+		t.Errorf("Expected previews not to count, got %d clicks used and %d clicks", stored.ClicksUsed, stored.ClickCount)
+	}
+
+	if _, err := svc.GetOriginalURL(ctx, alias, nil); err != nil {
+		t.Fatalf("GetOriginalURL returned error: %v", err)
+	}
+	if _, err := svc.PreviewURL(ctx, alias, nil); !errors.Is(err, domain.ErrClickLimitReached) {
+		t.Errorf("Expected the preview of a used-up link to fail, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strings"
+
+	"url-shortener/internal/repository"
+)
+
+// Code generator names, as used in configuration
+const (
+	GeneratorSequential = "sequential"
+	GeneratorFeistel    = "feistel"
+	GeneratorRandom     = "random"
+)
+
+// Default code lengths of the generators that do not follow the ID's magnitude
+const (
+	defaultFeistelLength = 6
+	defaultRandomLength  = 8
+)
+
+// feistelRounds is the number of rounds of the Feistel network; four rounds
+// make a pseudorandom permutation
+const feistelRounds = 4
+
+// CodeGenerator produces short codes for new links. Codes need not be unique:
+// the URL service discards codes that are already in use and asks for more.
+type CodeGenerator interface {
+	Generate(ctx context.Context, n int) ([]string, error)
+}
+
+// NewCodeGenerator creates the generator with the given name. minLength is the
+// minimum code length (0 for the generator's default); key is the secret the
+// Feistel generator permutes IDs with.
+func NewCodeGenerator(name string, store repository.URLStore, minLength int, key string) (CodeGenerator, error) {
+	switch name {
+	case "", GeneratorSequential:
+		return NewSequentialGenerator(store, minLength), nil
+	case GeneratorFeistel:
+		if key == "" {
+			return nil, errors.New("the feistel code generator requires a key")
+		}
+		return NewFeistelGenerator(store, []byte(key), minLength)
+	case GeneratorRandom:
+		return NewRandomGenerator(minLength), nil
+	default:
+		return nil, fmt.Errorf("unknown code generator %q", name)
+	}
+}
+
+// SequentialGenerator Base62-encodes IDs from the URL sequence. Codes are as
+// short as possible but reveal how many links exist and can be enumerated.
+type SequentialGenerator struct {
+	store     repository.URLStore
+	minLength int
+}
+
+// NewSequentialGenerator creates a sequential generator whose codes are
+// zero-padded to at least minLength characters
+func NewSequentialGenerator(store repository.URLStore, minLength int) *SequentialGenerator {
+	return &SequentialGenerator{store: store, minLength: minLength}
+}
+
+// Generate returns codes for the next n IDs
+func (g *SequentialGenerator) Generate(ctx context.Context, n int) ([]string, error) {
+	ids, err := g.store.GetNextIDs(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, len(ids))
+	for i, id := range ids {
+		codes[i] = padCode(Encode(id), g.minLength)
+	}
+	return codes, nil
+}
+
+// FeistelGenerator maps IDs from the URL sequence through a keyed permutation
+// before encoding them, so codes look random yet never collide. IDs fill all
+// codes of the minimum length first, then those one character longer, and so on.
+type FeistelGenerator struct {
+	store     repository.URLStore
+	key       []byte
+	minLength int
+}
+
+// NewFeistelGenerator creates a Feistel generator keyed with key whose codes
+// are at least minLength (by default 6) characters long
+func NewFeistelGenerator(store repository.URLStore, key []byte, minLength int) (*FeistelGenerator, error) {
+	if minLength <= 0 {
+		minLength = defaultFeistelLength
+	}
+	if minLength > maxFeistelLength {
+		return nil, fmt.Errorf("feistel codes can be at most %d characters long", maxFeistelLength)
+	}
+	return &FeistelGenerator{store: store, key: key, minLength: minLength}, nil
+}
+
+// maxFeistelLength keeps every code length's ID range within 63 bits
+const maxFeistelLength = 10
+
+// Generate returns codes for the next n IDs
+func (g *FeistelGenerator) Generate(ctx context.Context, n int) ([]string, error) {
+	ids, err := g.store.GetNextIDs(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, len(ids))
+	for i, id := range ids {
+		code, err := g.code(uint64(id))
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// code maps id to a code. The IDs are split into consecutive ranges, one per
+// code length, and each is permuted within the codes of its length.
+func (g *FeistelGenerator) code(id uint64) (string, error) {
+	offset := id
+	for length := g.minLength; length <= maxFeistelLength; length++ {
+		size := pow62(length)
+		if offset < size {
+			return padCode(Encode(int64(g.permute(offset, size, length))), length), nil
+		}
+		offset -= size
+	}
+	return "", fmt.Errorf("ID %d is beyond the range of feistel codes", id)
+}
+
+// permute applies a keyed Feistel network over the smallest even number of
+// bits covering size, walking the cycle until the result falls below size
+func (g *FeistelGenerator) permute(x, size uint64, length int) uint64 {
+	width := bits.Len64(size - 1)
+	width += width % 2
+	half := uint(width / 2)
+	mask := uint64(1)<<half - 1
+
+	for {
+		left, right := x>>half, x&mask
+		for round := 0; round < feistelRounds; round++ {
+			left, right = right, left^(g.round(round, length, right)&mask)
+		}
+		x = left<<half | right
+		if x < size {
+			return x
+		}
+	}
+}
+
+// round is the Feistel round function: an HMAC of the round, the code length
+// and the right half under the generator's key
+func (g *FeistelGenerator) round(round, length int, right uint64) uint64 {
+	var msg [10]byte
+	msg[0] = byte(round)
+	msg[1] = byte(length)
+	binary.BigEndian.PutUint64(msg[2:], right)
+
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// RandomGenerator draws codes uniformly at random from crypto/rand. Codes are
+// unrelated to IDs, so collisions are possible and retried by the service.
+type RandomGenerator struct {
+	length int
+}
+
+// NewRandomGenerator creates a random generator of codes that are length
+// (by default 8) characters long
+func NewRandomGenerator(length int) *RandomGenerator {
+	if length <= 0 {
+		length = defaultRandomLength
+	}
+	return &RandomGenerator{length: length}
+}
+
+// Generate returns n random codes
+func (g *RandomGenerator) Generate(_ context.Context, n int) ([]string, error) {
+	alphabet := big.NewInt(int64(len(base62Chars)))
+
+	codes := make([]string, n)
+	for i := range codes {
+		var b strings.Builder
+		for j := 0; j < g.length; j++ {
+			c, err := rand.Int(rand.Reader, alphabet)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate random code: %w", err)
+			}
+			b.WriteByte(base62Chars[c.Int64()])
+		}
+		codes[i] = b.String()
+	}
+	return codes, nil
+}
+
+// padCode left-pads a Base62 code with zeros (which keeps its value) to length
+func padCode(code string, length int) string {
+	if len(code) >= length {
+		return code
+	}
+	return strings.Repeat(string(base62Chars[0]), length-len(code)) + code
+}
+
+// pow62 returns 62 to the power of n
+func pow62(n int) uint64 {
+	result := uint64(1)
+	for i := 0; i < n; i++ {
+		result *= uint64(len(base62Chars))
+	}
+	return result
+}
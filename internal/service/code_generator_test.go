@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/repository"
+)
+
+func TestSequentialGenerator(t *testing.T) {
+	gen := NewSequentialGenerator(repository.NewMemoryRepository(), 4)
+
+	codes, err := gen.Generate(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+	if codes[0] != "0001" || codes[1] != "0002" {
+		t.Errorf("Expected zero-padded sequential codes, got %v", codes)
+	}
+	if id, _ := Decode(codes[1]); id != 2 {
+		t.Errorf("Expected padding to keep the encoded ID, got %d", id)
+	}
+}
+
+func TestFeistelGenerator_Bijective(t *testing.T) {
+	gen, err := NewFeistelGenerator(repository.NewMemoryRepository(), []byte("secret"), 2)
+	if err != nil {
+		t.Fatalf("NewFeistelGenerator returned error: %v", err)
+	}
+
+	size := pow62(2)
+	seen := make(map[string]bool, size)
+	sequential := 0
+	for id := uint64(0); id < size; id++ {
+		code, err := gen.code(id)
+		if err != nil {
+			t.Fatalf("code(%d) returned error: %v", id, err)
+		}
+		if len(code) != 2 {
+			t.Fatalf("Expected 2-character code for ID %d, got %q", id, code)
+		}
+		if seen[code] {
+			t.Fatalf("Code %q generated twice", code)
+		}
+		seen[code] = true
+		if code == padCode(Encode(int64(id)), 2) {
+			sequential++
+		}
+	}
+	if sequential > int(size)/10 {
+		t.Errorf("Expected codes to be permuted, %d of %d matched the ID", sequential, size)
+	}
+
+	next, err := gen.code(size)
+	if err != nil || len(next) != 3 {
+		t.Errorf("Expected IDs past the 2-character range to get 3-character codes, got %q (err: %v)", next, err)
+	}
+}
+
+func TestFeistelGenerator_Keyed(t *testing.T) {
+	a, _ := NewFeistelGenerator(repository.NewMemoryRepository(), []byte("key-a"), 0)
+	b, _ := NewFeistelGenerator(repository.NewMemoryRepository(), []byte("key-b"), 0)
+
+	codeA, _ := a.code(12345)
+	again, _ := a.code(12345)
+	codeB, _ := b.code(12345)
+	if codeA != again {
+		t.Errorf("Expected the same code for the same key, got %q and %q", codeA, again)
+	}
+	if codeA == codeB {
+		t.Errorf("Expected different keys to give different codes, both were %q", codeA)
+	}
+	if len(codeA) != defaultFeistelLength {
+		t.Errorf("Expected default length %d, got %q", defaultFeistelLength, codeA)
+	}
+}
+
+func TestRandomGenerator(t *testing.T) {
+	codes, err := NewRandomGenerator(10).Generate(context.Background(), 50)
+	if err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 10 || strings.Trim(code, base62Chars) != "" {
+			t.Errorf("Expected 10 Base62 characters, got %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != len(codes) {
+		t.Errorf("Expected distinct random codes, got %d of %d", len(seen), len(codes))
+	}
+}
+
+func TestNewCodeGenerator(t *testing.T) {
+	store := repository.NewMemoryRepository()
+
+	if _, err := NewCodeGenerator(GeneratorFeistel, store, 0, ""); err == nil {
+		t.Error("Expected error for a feistel generator without key")
+	}
+	if _, err := NewCodeGenerator("uuid", store, 0, ""); err == nil {
+		t.Error("Expected error for an unknown generator")
+	}
+	if _, err := NewCodeGenerator(GeneratorFeistel, store, maxFeistelLength+1, "key"); err == nil {
+		t.Error("Expected error for an unsupported feistel length")
+	}
+	for _, name := range []string{GeneratorSequential, GeneratorRandom} {
+		if _, err := NewCodeGenerator(name, store, 0, ""); err != nil {
+			t.Errorf("NewCodeGenerator(%q) returned error: %v", name, err)
+		}
+	}
+}
+
+// fixedGenerator hands out predetermined codes
+type fixedGenerator struct {
+	codes []string
+}
+
+func (g *fixedGenerator) Generate(_ context.Context, n int) ([]string, error) {
+	codes := g.codes[:n]
+	g.codes = g.codes[n:]
+	return codes, nil
+}
+
+func TestShortenURL_RetriesCollidingCodes(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	gen := &fixedGenerator{codes: []string{"taken", "api", "free1", "free2"}}
+	svc := NewURLService(store, repository.NewMemoryCache(), testBaseURL, WithCodeGenerator(gen))
+	ctx := context.Background()
+
+	if err := store.CreateURL(ctx, &domain.URL{ShortCode: "taken", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+
+	resp, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.org"}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if resp.ShortURL != testBaseURL+"/free1" {
+		t.Errorf("Expected taken and reserved codes to be skipped, got %q", resp.ShortURL)
+	}
+}
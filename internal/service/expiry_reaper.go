@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+)
+
+// reaperLockID is the PostgreSQL advisory lock key that keeps the expiry reaper
+// running on a single replica at a time
+const reaperLockID int64 = 7262002
+
+// ExpiryReaper periodically deletes URLs that expired longer than the
+// retention period ago in bounded batches, and evicts their cache entries.
+// Until then, expired links keep answering 410 and reporting analytics.
+type ExpiryReaper struct {
+	store     repository.ExpiryStore
+	cache     repository.URLCache
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+	reaped    atomic.Int64
+	metrics   *metrics.Metrics
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// ExpiryReaperOption configures optional ExpiryReaper behaviour
+type ExpiryReaperOption func(*ExpiryReaper)
+
+// WithReapMetrics counts the URLs the reaper deletes in m
+func WithReapMetrics(m *metrics.Metrics) ExpiryReaperOption {
+	return func(r *ExpiryReaper) {
+		r.metrics = m
+	}
+}
+
+// NewExpiryReaper creates an expiry reaper that runs every interval and deletes
+// at most batchSize URLs per statement, once they expired more than retention ago
+func NewExpiryReaper(store repository.ExpiryStore, cache repository.URLCache, interval time.Duration, batchSize int, retention time.Duration, opts ...ExpiryReaperOption) *ExpiryReaper {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	if retention < 0 {
+		retention = 0
+	}
+
+	r := &ExpiryReaper{
+		store:     store,
+		cache:     cache,
+		interval:  interval,
+		batchSize: batchSize,
+		retention: retention,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start runs the reaper in the background
+func (r *ExpiryReaper) Start() {
+	go r.run()
+}
+
+// Stop halts the reaper, waiting for an in-progress run to finish
+func (r *ExpiryReaper) Stop(ctx context.Context) error {
+	close(r.stop)
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reaped returns the total number of URLs reaped by this process
+func (r *ExpiryReaper) Reaped() int64 {
+	return r.reaped.Load()
+}
+
+// RunOnce deletes expired URLs batch by batch until none are left, unless
+// another replica holds the reaper lock. It returns the number of URLs deleted.
+func (r *ExpiryReaper) RunOnce(ctx context.Context) (int, error) {
+	total := 0
+
+	expiredBefore := time.Now().Add(-r.retention)
+	ran, err := r.store.WithTryAdvisoryLock(ctx, reaperLockID, func(ctx context.Context) error {
+		for {
+			shortCodes, err := r.store.DeleteExpiredURLs(ctx, expiredBefore, r.batchSize)
+			if err != nil {
+				return err
+			}
+
+			for _, shortCode := range shortCodes {
+				if err := r.cache.Delete(ctx, shortCode); err != nil {
+					slog.ErrorContext(ctx, "Failed to evict reaped URL from cache", logging.ShortCodeKey, shortCode, "error", err)
+				}
+			}
+			total += len(shortCodes)
+			r.reaped.Add(int64(len(shortCodes)))
+			r.metrics.LinksReaped(len(shortCodes))
+
+			if len(shortCodes) < r.batchSize || ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+	})
+	if !ran && err == nil {
+		slog.InfoContext(ctx, "Expiry reaper skipped: another replica holds the lock")
+	}
+
+	return total, err
+}
+
+// run reaps on every tick until stopped
+func (r *ExpiryReaper) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		go func() {
+			// Abort a long-running pass as soon as the reaper is stopped
+			select {
+			case <-r.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		reaped, err := r.RunOnce(ctx)
+		if err != nil {
+			slog.Error("Expiry reaper failed", "reaped", reaped, "error", err)
+		} else if reaped > 0 {
+			slog.Info("Expiry reaper deleted expired URLs", "reaped", reaped)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+)
+
+func TestExpiryReaper_RunOnce(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	cache := repository.NewMemoryCache()
+	ctx := context.Background()
+
+	past := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	for code, expiresAt := range map[string]*time.Time{
+		"gone1": &past, "gone2": &past, "gone3": &past, "retained": &recent, "alive": &future, "forever": nil,
+	} {
+		if err := store.CreateURL(ctx, &domain.URL{ShortCode: code, OriginalURL: "https://example.com", ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("CreateURL returned error: %v", err)
+		}
+		_ = cache.Set(ctx, code, &domain.Redirect{URL: "https://example.com"}, time.Hour)
+	}
+
+	m := metrics.New()
+	reaper := NewExpiryReaper(store, cache, time.Hour, 2, 24*time.Hour, WithReapMetrics(m))
+	reaped, err := reaper.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce returned error: %v", err)
+	}
+	if reaped != 3 || reaper.Reaped() != 3 {
+		t.Errorf("Expected 3 URLs reaped, got %d (total %d)", reaped, reaper.Reaped())
+	}
+
+	for _, code := range []string{"gone1", "gone2", "gone3"} {
+		if exists, _ := store.CheckShortCodeExists(ctx, code); exists {
+			t.Errorf("Expected %s to be deleted", code)
+		}
+		if exists, _ := cache.Exists(ctx, code); exists {
+			t.Errorf("Expected %s to be evicted from cache", code)
+		}
+	}
+	for _, code := range []string{"retained", "alive", "forever"} {
+		if exists, _ := store.CheckShortCodeExists(ctx, code); !exists {
+			t.Errorf("Expected %s to be kept", code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "shortener_links_reaped_total 3") {
+		t.Error("Expected the reaped URLs to be counted in the metrics")
+	}
+}
+
+func TestExpiryReaper_KeepsAnalyticsDuringRetention(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	cache := repository.NewMemoryCache()
+	svc := NewURLService(store, cache, testBaseURL)
+	ctx := context.Background()
+
+	owner, expired := testOwner, time.Now().Add(-time.Hour)
+	if err := store.CreateURL(ctx, &domain.URL{ShortCode: "ended", OriginalURL: "https://example.com", UserID: &owner, ExpiresAt: &expired}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+
+	if _, err := NewExpiryReaper(store, cache, time.Hour, 10, 24*time.Hour).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce returned error: %v", err)
+	}
+	if _, err := svc.GetOriginalURL(ctx, "ended", nil); !errors.Is(err, domain.ErrExpired) {
+		t.Errorf("Expected a retained link to stay expired, got %v", err)
+	}
+	if _, err := svc.GetAnalytics(ctx, "ended", testOwner, domain.AnalyticsQuery{}); err != nil {
+		t.Errorf("Expected analytics of a retained link, got %v", err)
+	}
+}
+
+func TestExpiryReaper_SkipsWhenLockHeld(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	if err := store.CreateURL(ctx, &domain.URL{ShortCode: "gone", OriginalURL: "https://example.com", ExpiresAt: &past}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+
+	reaper := NewExpiryReaper(store, repository.NewMemoryCache(), time.Hour, 10, 0)
+	_, err := store.WithTryAdvisoryLock(ctx, reaperLockID, func(ctx context.Context) error {
+		reaped, err := reaper.RunOnce(ctx)
+		if reaped != 0 {
+			t.Errorf("Expected no URLs reaped while another replica holds the lock, got %d", reaped)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("RunOnce returned error: %v", err)
+	}
+
+	if exists, _ := store.CheckShortCodeExists(ctx, "gone"); !exists {
+		t.Error("Expected expired URL to survive while the lock is held elsewhere")
+	}
+}
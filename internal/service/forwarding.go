@@ -0,0 +1,74 @@
+package service
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"url-shortener/internal/domain"
+)
+
+// forwards reports whether a visit may be resolved by redirect: a visit with
+// a path after the short code only reaches links that forward the path, so
+// /code/anything still does not exist for other links
+func forwards(redirect *domain.Redirect, visit *domain.Visit) bool {
+	return visit == nil || visit.Path == "" || redirect.ForwardPath
+}
+
+// forward passes the visited path and query through to target, as enabled
+// for the redirect. Only the path and query of the parsed target are
+// changed, so the result always stays on the target's scheme and host.
+func forward(target string, redirect *domain.Redirect, visit *domain.Visit) string {
+	if visit == nil || (!redirect.ForwardPath || visit.Path == "") && (!redirect.ForwardQuery || visit.Query == "") {
+		return target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Opaque != "" {
+		return target
+	}
+	if redirect.ForwardPath && visit.Path != "" {
+		joinPath(u, visit.Path)
+	}
+	if redirect.ForwardQuery && visit.Query != "" {
+		mergeQuery(u, visit.Query)
+	}
+	return u.String()
+}
+
+// joinPath appends suffix to the path of u. Dot segments are resolved within
+// the suffix, so it can never climb above the target's path.
+func joinPath(u *url.URL, suffix string) {
+	cleaned := path.Clean("/" + suffix)
+	if strings.HasSuffix(suffix, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	if u.RawPath != "" {
+		// Keep the target's own escaping, e.g. of an encoded "/"
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/") + (&url.URL{Path: cleaned}).EscapedPath()
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + cleaned
+}
+
+// mergeQuery adds the parameters of the visited query string to the query of
+// u. Parameters the target already sets keep the target's values, so visitors
+// cannot override them; malformed pairs are dropped.
+func mergeQuery(u *url.URL, rawQuery string) {
+	own, _ := url.ParseQuery(u.RawQuery)
+	visited, _ := url.ParseQuery(rawQuery)
+
+	extra := url.Values{}
+	for key, values := range visited {
+		if _, ok := own[key]; !ok {
+			extra[key] = values
+		}
+	}
+	if len(extra) == 0 {
+		return
+	}
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += extra.Encode()
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"url-shortener/internal/domain"
+)
+
+func TestForward(t *testing.T) {
+	both := &domain.Redirect{ForwardPath: true, ForwardQuery: true}
+	tests := []struct {
+		name     string
+		target   string
+		redirect *domain.Redirect
+		path     string
+		query    string
+		want     string
+	}{
+		{"path and query", "https://example.com/docs", both, "/api/v2", "x=1", "https://example.com/docs/api/v2?x=1"},
+		{"trailing slash on target", "https://example.com/docs/", both, "/api", "", "https://example.com/docs/api"},
+		{"trailing slash on suffix", "https://example.com/docs", both, "/api/", "", "https://example.com/docs/api/"},
+		{"root target", "https://example.com", both, "/a", "", "https://example.com/a"},
+		{"query merged", "https://example.com/p?ref=abc", both, "", "x=1&y=2", "https://example.com/p?ref=abc&x=1&y=2"},
+		{"target params win", "https://example.com/p?ref=abc", both, "", "ref=evil&x=1", "https://example.com/p?ref=abc&x=1"},
+		{"dot segments", "https://example.com/docs", both, "/a/../../../admin", "", "https://example.com/docs/admin"},
+		{"no host change", "https://example.com", both, "//evil.com/x", "", "https://example.com/evil.com/x"},
+		{"userinfo in suffix", "https://example.com", both, "/@evil.com", "", "https://example.com/@evil.com"},
+		{"escaped", "https://example.com/docs", both, "/a b", "q=a+b", "https://example.com/docs/a%20b?q=a+b"},
+		{"fragment kept", "https://example.com/docs#top", both, "/a", "x=1", "https://example.com/docs/a?x=1#top"},
+		{"path only", "https://example.com/docs", &domain.Redirect{ForwardPath: true}, "/a", "x=1", "https://example.com/docs/a"},
+		{"query only", "https://example.com/docs", &domain.Redirect{ForwardQuery: true}, "", "x=1", "https://example.com/docs?x=1"},
+		{"not forwarded", "https://example.com/docs", &domain.Redirect{}, "", "x=1", "https://example.com/docs"},
+	}
+	for _, tt := range tests {
+		got := forward(tt.target, tt.redirect, &domain.Visit{Path: tt.path, Query: tt.query})
+		if got != tt.want {
+			t.Errorf("%s: forward = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetOriginalURL_Forwarding(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	section, plain := "docs", "plain"
+	for _, req := range []*domain.CreateURLRequest{
+		{LongURL: "https://example.com/docs", CustomAlias: &section, ForwardPath: true, ForwardQuery: true},
+		{LongURL: "https://example.com/page", CustomAlias: &plain},
+	} {
+		if _, err := svc.ShortenURL(ctx, req, testOwner); err != nil {
+			t.Fatalf("ShortenURL returned error: %v", err)
+		}
+	}
+
+	// The first pass resolves from the store, the second from the cache
+	for _, pass := range []string{"store", "cache"} {
+		dest, err := svc.GetOriginalURL(ctx, section, &domain.Visit{Path: "/api/v2", Query: "x=1"})
+		if err != nil || dest.URL != "https://example.com/docs/api/v2?x=1" {
+			t.Errorf("%s: expected the path and query to be forwarded, got %+v, %v", pass, dest, err)
+		}
+
+		if _, err := svc.GetOriginalURL(ctx, plain, &domain.Visit{Path: "/api"}); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("%s: expected a path on a non-forwarding link to be not found, got %v", pass, err)
+		}
+		dest, err = svc.GetOriginalURL(ctx, plain, &domain.Visit{Query: "x=1"})
+		if err != nil || dest.URL != "https://example.com/page" {
+			t.Errorf("%s: expected the query to be ignored, got %+v, %v", pass, dest, err)
+		}
+	}
+
+	off := false
+	if _, err := svc.UpdateURL(ctx, section, testOwner, &domain.UpdateURLRequest{ForwardPath: &off}); err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if _, err := svc.GetOriginalURL(ctx, section, &domain.Visit{Path: "/api"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected path forwarding to be switched off, got %v", err)
+	}
+}
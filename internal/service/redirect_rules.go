@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/internal/domain"
+)
+
+// maxRedirectRules bounds the redirect rules of one link
+const maxRedirectRules = 20
+
+// Operating systems and device classes that redirect rules can match
+var (
+	ruleOperatingSystems = map[string]bool{
+		"ios": true, "android": true, "windows": true, "macos": true, "linux": true, "chromeos": true,
+	}
+	ruleDevices = map[string]bool{"mobile": true, "tablet": true, "desktop": true}
+)
+
+// languageTag matches language tags such as "de" or "pt-BR"
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{1,8})*$`)
+
+// timeOfDayLayout is the format of the bounds of a rule's time window
+const timeOfDayLayout = "15:04"
+
+// CountryLookup resolves client IPs to ISO 3166-1 alpha-2 country codes for
+// redirect rules. It returns "" for addresses of unknown location.
+type CountryLookup interface {
+	Country(ip net.IP) (string, error)
+}
+
+// compileRules validates redirect rules and brings them into the form they are
+// stored and evaluated in: targets checked against the URL policy (and
+// normalized if normalize is set), condition values in canonical case and
+// times formatted uniformly
+func (s *URLService) compileRules(rules []domain.RedirectRule, normalize bool) ([]domain.RedirectRule, error) {
+	if len(rules) > maxRedirectRules {
+		return nil, domain.Invalid(fmt.Sprintf("at most %d redirect rules are allowed", maxRedirectRules))
+	}
+
+	compiled := make([]domain.RedirectRule, 0, len(rules))
+	for i, rule := range rules {
+		targetURL, _, err := s.destination(rule.TargetURL, normalize)
+		if err != nil {
+			var appErr *domain.Error
+			if errors.As(err, &appErr) && appErr.Reason != "" {
+				return nil, domain.URLRejected(appErr.Reason, fmt.Sprintf("rule %d: %s", i+1, appErr.Message))
+			}
+			return nil, err
+		}
+
+		conditions, err := compileConditions(rule.Conditions)
+		if err != nil {
+			return nil, domain.Invalid(fmt.Sprintf("rule %d: %v", i+1, err))
+		}
+		compiled = append(compiled, domain.RedirectRule{TargetURL: targetURL, Conditions: conditions})
+	}
+	return compiled, nil
+}
+
+// compileConditions validates and normalizes the conditions of one rule
+func compileConditions(c domain.RuleConditions) (domain.RuleConditions, error) {
+	var out domain.RuleConditions
+	var err error
+
+	if out.OS, err = compileValues("os", c.OS, strings.ToLower, func(v string) bool { return ruleOperatingSystems[v] }); err != nil {
+		return out, err
+	}
+	if out.Devices, err = compileValues("device", c.Devices, strings.ToLower, func(v string) bool { return ruleDevices[v] }); err != nil {
+		return out, err
+	}
+	if out.Languages, err = compileValues("language", c.Languages, strings.ToLower, languageTag.MatchString); err != nil {
+		return out, err
+	}
+	if out.Countries, err = compileValues("country", c.Countries, strings.ToUpper, isCountryCode); err != nil {
+		return out, err
+	}
+
+	if c.TimeOfDay != nil {
+		window, err := compileTimeWindow(*c.TimeOfDay)
+		if err != nil {
+			return out, err
+		}
+		out.TimeOfDay = &window
+	}
+
+	if out.OS == nil && out.Devices == nil && out.Languages == nil && out.Countries == nil && out.TimeOfDay == nil {
+		return out, errors.New("at least one condition is required")
+	}
+	return out, nil
+}
+
+// compileValues canonicalizes the values of a condition, dropping duplicates,
+// and checks that each one is valid
+func compileValues(name string, values []string, canonical func(string) string, valid func(string) bool) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = canonical(strings.TrimSpace(value))
+		if !valid(value) {
+			return nil, fmt.Errorf("unsupported %s %q", name, value)
+		}
+		if !seen[value] {
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out, nil
+}
+
+// compileTimeWindow validates a time window and formats its bounds as HH:MM
+func compileTimeWindow(w domain.TimeWindow) (domain.TimeWindow, error) {
+	from, err := time.Parse(timeOfDayLayout, w.From)
+	if err != nil {
+		return w, fmt.Errorf("invalid time_of_day.from %q: want HH:MM", w.From)
+	}
+	to, err := time.Parse(timeOfDayLayout, w.To)
+	if err != nil {
+		return w, fmt.Errorf("invalid time_of_day.to %q: want HH:MM", w.To)
+	}
+	if from.Equal(to) {
+		return w, errors.New("time_of_day.from and time_of_day.to must differ")
+	}
+	if w.TimeZone != "" {
+		if _, err := loadLocation(w.TimeZone); err != nil {
+			return w, fmt.Errorf("unknown time zone %q", w.TimeZone)
+		}
+	}
+	return domain.TimeWindow{
+		From:     from.Format(timeOfDayLayout),
+		To:       to.Format(timeOfDayLayout),
+		TimeZone: w.TimeZone,
+	}, nil
+}
+
+// isCountryCode reports whether s has the form of an ISO 3166-1 alpha-2 code
+func isCountryCode(s string) bool {
+	return len(s) == 2 && 'A' <= s[0] && s[0] <= 'Z' && 'A' <= s[1] && s[1] <= 'Z'
+}
+
+// matchRule returns the target of the first of rules that matches the visit
+// at now; ok is false if none does
+func (s *URLService) matchRule(ctx context.Context, rules []domain.RedirectRule, visit *domain.Visit, now time.Time) (target string, ok bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+	v := &ruleVisit{visit: visit, countries: s.countries}
+	if visit == nil {
+		v.visit = &domain.Visit{}
+	}
+	for _, rule := range rules {
+		if v.matches(ctx, rule.Conditions, now) {
+			return rule.TargetURL, true
+		}
+	}
+	return "", false
+}
+
+// ruleVisit is a visit as seen by redirect rules. The attributes rules match
+// on are derived from the request only when a rule first needs them.
+type ruleVisit struct {
+	visit     *domain.Visit
+	countries CountryLookup
+
+	agentParsed     bool
+	os, device      string
+	languageParsed  bool
+	language        string
+	countryResolved bool
+	country         string
+}
+
+// matches reports whether the visit at now meets all conditions c. Country is
+// checked last, as it is the only condition that may need a lookup.
+func (v *ruleVisit) matches(ctx context.Context, c domain.RuleConditions, now time.Time) bool {
+	if len(c.OS) > 0 || len(c.Devices) > 0 {
+		os, device := v.userAgent()
+		if len(c.OS) > 0 && !slices.Contains(c.OS, os) || len(c.Devices) > 0 && !slices.Contains(c.Devices, device) {
+			return false
+		}
+	}
+	if len(c.Languages) > 0 && !matchesLanguage(c.Languages, v.preferredLanguage()) {
+		return false
+	}
+	if c.TimeOfDay != nil && !inTimeWindow(*c.TimeOfDay, now) {
+		return false
+	}
+	if len(c.Countries) > 0 && !slices.Contains(c.Countries, v.resolveCountry(ctx)) {
+		return false
+	}
+	return true
+}
+
+func (v *ruleVisit) userAgent() (os, device string) {
+	if !v.agentParsed {
+		v.os, v.device = parseUserAgent(v.visit.UserAgent)
+		v.agentParsed = true
+	}
+	return v.os, v.device
+}
+
+func (v *ruleVisit) preferredLanguage() string {
+	if !v.languageParsed {
+		v.language = preferredLanguage(v.visit.AcceptLanguage)
+		v.languageParsed = true
+	}
+	return v.language
+}
+
+func (v *ruleVisit) resolveCountry(ctx context.Context) string {
+	if !v.countryResolved {
+		v.countryResolved = true
+		ip := net.ParseIP(v.visit.ClientIP)
+		if v.countries == nil || ip == nil {
+			return ""
+		}
+		country, err := v.countries.Country(ip)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to look up country of client IP", "error", err)
+		}
+		v.country = strings.ToUpper(country)
+	}
+	return v.country
+}
+
+// parseUserAgent derives the operating system and device class (mobile, tablet
+// or desktop) from a User-Agent header. The OS is "" if it is not recognized.
+func parseUserAgent(userAgent string) (os, device string) {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		os = "ios"
+	case strings.Contains(ua, "android"):
+		os = "android"
+	case strings.Contains(ua, "cros "):
+		os = "chromeos"
+	case strings.Contains(ua, "windows"):
+		os = "windows"
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		os = "macos"
+	case strings.Contains(ua, "linux"):
+		os = "linux"
+	}
+
+	switch {
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		os == "android" && !strings.Contains(ua, "mobile"):
+		device = "tablet"
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"),
+		strings.Contains(ua, "windows phone"):
+		device = "mobile"
+	default:
+		device = "desktop"
+	}
+	return os, device
+}
+
+// preferredLanguage returns the lowercased language tag with the highest
+// quality in an Accept-Language header, or "" if there is none
+func preferredLanguage(acceptLanguage string) string {
+	type tag struct {
+		name    string
+		quality float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "*" {
+			continue
+		}
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality > 0 {
+			tags = append(tags, tag{name: name, quality: quality})
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+	return tags[0].name
+}
+
+// matchesLanguage reports whether language equals one of languages or is a
+// regional variant of one ("de" matches "de-at")
+func matchesLanguage(languages []string, language string) bool {
+	for _, l := range languages {
+		if language == l || strings.HasPrefix(language, l+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// inTimeWindow reports whether now falls within the daily window w. The
+// window was validated when the rule was created; an invalid one never matches.
+func inTimeWindow(w domain.TimeWindow, now time.Time) bool {
+	from, err1 := time.Parse(timeOfDayLayout, w.From)
+	to, err2 := time.Parse(timeOfDayLayout, w.To)
+	loc, err3 := loadLocation(w.TimeZone)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return false
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+	if start < end {
+		return start <= minute && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// locations caches loaded time zones, which are otherwise read from disk on
+// every time.LoadLocation call
+var locations sync.Map
+
+// loadLocation returns the named time zone (UTC if name is empty)
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/repository"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+// countryMap is a CountryLookup over fixed IP addresses
+type countryMap map[string]string
+
+func (m countryMap) Country(ip net.IP) (string, error) {
+	return m[ip.String()], nil
+}
+
+func TestGetOriginalURL_RedirectRules(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	cache := repository.NewMemoryCache()
+	svc := NewURLService(store, cache, testBaseURL, WithCountryLookup(countryMap{"203.0.113.7": "DE"}))
+	ctx := context.Background()
+
+	alias := "smart"
+	_, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/app",
+		CustomAlias: &alias,
+		Rules: []domain.RedirectRule{
+			{TargetURL: "https://apps.apple.com/app/id1", Conditions: domain.RuleConditions{OS: []string{"iOS"}}},
+			{TargetURL: "https://play.google.com/store/apps/details?id=app", Conditions: domain.RuleConditions{OS: []string{"android"}}},
+			{TargetURL: "https://example.de/app", Conditions: domain.RuleConditions{Countries: []string{"de"}, Devices: []string{"desktop"}}},
+			{TargetURL: "https://example.com/fr/app", Conditions: domain.RuleConditions{Languages: []string{"fr"}}},
+		},
+	}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		visit *domain.Visit
+		want  string
+	}{
+		{"iOS", &domain.Visit{UserAgent: iPhoneUA, ClientIP: "203.0.113.7"}, "https://apps.apple.com/app/id1"},
+		{"Android", &domain.Visit{UserAgent: androidUA}, "https://play.google.com/store/apps/details?id=app"},
+		{"desktop in Germany", &domain.Visit{UserAgent: desktopUA, ClientIP: "203.0.113.7"}, "https://example.de/app"},
+		{"French speaker", &domain.Visit{UserAgent: desktopUA, AcceptLanguage: "fr-CH, fr;q=0.9, en;q=0.8"}, "https://example.com/fr/app"},
+		{"everyone else", &domain.Visit{UserAgent: desktopUA, AcceptLanguage: "en-US,fr;q=0.5"}, "https://example.com/app"},
+		{"no visit", nil, "https://example.com/app"},
+	}
+	// The first pass resolves from the store, the second from the cached rules
+	for _, pass := range []string{"store", "cache"} {
+		for _, tt := range tests {
+			dest, err := svc.GetOriginalURL(ctx, alias, tt.visit)
+			if err != nil {
+				t.Fatalf("%s (%s): GetOriginalURL returned error: %v", tt.name, pass, err)
+			}
+			if dest.URL != tt.want {
+				t.Errorf("%s (%s): expected %q, got %q", tt.name, pass, tt.want, dest.URL)
+			}
+		}
+		cached, err := cache.Get(ctx, alias)
+		if err != nil || len(cached.Rules) != 4 {
+			t.Fatalf("Expected the rules to be cached, got %+v (err: %v)", cached, err)
+		}
+	}
+}
+
+func TestShortenURL_InvalidRules(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	target := "https://example.com/other"
+	tests := []struct {
+		name string
+		rule domain.RedirectRule
+	}{
+		{"no conditions", domain.RedirectRule{TargetURL: target}},
+		{"unknown OS", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{OS: []string{"beos"}}}},
+		{"unknown device", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{Devices: []string{"watch"}}}},
+		{"invalid country", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{Countries: []string{"DEU"}}}},
+		{"invalid language", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{Languages: []string{"en_US"}}}},
+		{"invalid time", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{TimeOfDay: &domain.TimeWindow{From: "9am", To: "17:00"}}}},
+		{"empty window", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{TimeOfDay: &domain.TimeWindow{From: "09:00", To: "09:00"}}}},
+		{"unknown time zone", domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{TimeOfDay: &domain.TimeWindow{From: "09:00", To: "17:00", TimeZone: "Mars/Olympus"}}}},
+		{"rejected target", domain.RedirectRule{TargetURL: "http://127.0.0.1/", Conditions: domain.RuleConditions{OS: []string{"ios"}}}},
+	}
+	for _, tt := range tests {
+		_, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+			LongURL: "https://example.com",
+			Rules:   []domain.RedirectRule{tt.rule},
+		}, testOwner)
+		var appErr *domain.Error
+		if !errors.As(err, &appErr) || appErr.Status != 400 {
+			t.Errorf("%s: expected a 400 error, got %v", tt.name, err)
+		}
+	}
+
+	tooMany := make([]domain.RedirectRule, maxRedirectRules+1)
+	for i := range tooMany {
+		tooMany[i] = domain.RedirectRule{TargetURL: target, Conditions: domain.RuleConditions{OS: []string{"ios"}}}
+	}
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", Rules: tooMany}, testOwner); err == nil {
+		t.Error("Expected too many rules to be rejected")
+	}
+}
+
+func TestUpdateURL_ReplacesRules(t *testing.T) {
+	svc, _, cache := newTestService()
+	ctx := context.Background()
+
+	alias := "rules"
+	_, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com",
+		CustomAlias: &alias,
+		Rules:       []domain.RedirectRule{{TargetURL: "https://example.com/ios", Conditions: domain.RuleConditions{OS: []string{"ios"}}}},
+	}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	iPhone := &domain.Visit{UserAgent: iPhoneUA}
+	if dest, err := svc.GetOriginalURL(ctx, alias, iPhone); err != nil || dest.URL != "https://example.com/ios" {
+		t.Fatalf("Expected the iOS rule to apply, got %+v, %v", dest, err)
+	}
+
+	noRules := []domain.RedirectRule{}
+	if _, err := svc.UpdateURL(ctx, alias, testOwner, &domain.UpdateURLRequest{Rules: &noRules}); err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if _, err := cache.Get(ctx, alias); err == nil {
+		t.Error("Expected the cached rules to be invalidated")
+	}
+	if dest, err := svc.GetOriginalURL(ctx, alias, iPhone); err != nil || dest.URL != "https://example.com" {
+		t.Errorf("Expected the rules to be removed, got %+v, %v", dest, err)
+	}
+}
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		ua, os, device string
+	}{
+		{iPhoneUA, "ios", "mobile"},
+		{"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15", "ios", "tablet"},
+		{androidUA, "android", "mobile"},
+		{"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", "android", "tablet"},
+		{desktopUA, "windows", "desktop"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15", "macos", "desktop"},
+		{"Mozilla/5.0 (X11; CrOS x86_64 15633.69.0) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", "chromeos", "desktop"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "linux", "desktop"},
+		{"curl/8.4.0", "", "desktop"},
+	}
+	for _, tt := range tests {
+		os, device := parseUserAgent(tt.ua)
+		if os != tt.os || device != tt.device {
+			t.Errorf("parseUserAgent(%q) = %q, %q; want %q, %q", tt.ua, os, device, tt.os, tt.device)
+		}
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"de-AT":                     "de-at",
+		"en;q=0.5, de-CH, fr;q=0.9": "de-ch",
+		"*, es;q=0.8":               "es",
+		"fr;q=0, it;q=0.1":          "it",
+	}
+	for header, want := range tests {
+		if got := preferredLanguage(header); got != want {
+			t.Errorf("preferredLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestInTimeWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 15, hour, minute, 0, 0, time.UTC)
+	}
+
+	office := domain.TimeWindow{From: "09:00", To: "17:30"}
+	night := domain.TimeWindow{From: "22:00", To: "06:00"}
+	berlin := domain.TimeWindow{From: "09:00", To: "10:00", TimeZone: "Europe/Berlin"}
+
+	tests := []struct {
+		name   string
+		window domain.TimeWindow
+		now    time.Time
+		want   bool
+	}{
+		{"start is inclusive", office, at(9, 0), true},
+		{"end is exclusive", office, at(17, 30), false},
+		{"before", office, at(8, 59), false},
+		{"overnight late", night, at(23, 0), true},
+		{"overnight early", night, at(5, 59), true},
+		{"overnight day", night, at(12, 0), false},
+		{"time zone", berlin, at(8, 30), true},
+		{"time zone outside", berlin, at(9, 30), false},
+	}
+	for _, tt := range tests {
+		if got := inTimeWindow(tt.window, tt.now); got != tt.want {
+			t.Errorf("%s: inTimeWindow = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
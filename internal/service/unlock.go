@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"url-shortener/internal/domain"
+)
+
+// defaultUnlockTTL is how long unlocking a password-protected link lasts
+const defaultUnlockTTL = 10 * time.Minute
+
+// maxPasswordBytes is the longest password bcrypt can hash
+const maxPasswordBytes = 72
+
+// UnlockURL checks password against a password-protected short URL and issues
+// a signed token that lets the visitor follow the link until it expires
+func (s *URLService) UnlockURL(ctx context.Context, shortCode, password string) (*domain.UnlockResponse, error) {
+	ctx, span := startSpan(ctx, "UnlockURL", shortCodeAttr(shortCode))
+	defer span.End()
+
+	urlEntity, err := s.store.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	if urlEntity.Disabled {
+		return nil, domain.ErrDisabled
+	}
+	now := time.Now()
+	if urlEntity.IsExpired(now) {
+		return nil, domain.ErrExpired
+	}
+	if urlEntity.IsPending(now) {
+		return nil, domain.NotYetActive(*urlEntity.ActivatesAt)
+	}
+	if !urlEntity.IsProtected() {
+		return nil, domain.Invalid("URL is not password protected")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(*urlEntity.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return nil, domain.ErrInvalidPassword
+	}
+	if err != nil {
+		return nil, domain.Internal(fmt.Errorf("failed to verify password: %w", err))
+	}
+
+	expiresAt := time.Now().Add(s.unlockTTL).Truncate(time.Second)
+	return &domain.UnlockResponse{
+		ShortURL:  fmt.Sprintf("%s/%s", s.baseURL, shortCode),
+		ExpiresAt: expiresAt,
+		Token:     s.signUnlockToken(urlEntity, expiresAt),
+	}, nil
+}
+
+// signUnlockToken returns a token for urlEntity valid until expiresAt. The
+// password hash is part of the signature, so changing the password revokes
+// all tokens issued before.
+func (s *URLService) signUnlockToken(urlEntity *domain.URL, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + base64.RawURLEncoding.EncodeToString(s.unlockMAC(urlEntity, expiry))
+}
+
+// validUnlockToken reports whether token unlocks urlEntity and has not expired
+func (s *URLService) validUnlockToken(urlEntity *domain.URL, token string) bool {
+	expiry, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || !time.Now().Before(time.Unix(unix, 0)) {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, s.unlockMAC(urlEntity, expiry))
+}
+
+// unlockMAC signs a short code, token expiry and password hash
+func (s *URLService) unlockMAC(urlEntity *domain.URL, expiry string) []byte {
+	mac := hmac.New(sha256.New, s.unlockSecret)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s", urlEntity.ShortCode, expiry, *urlEntity.PasswordHash)
+	return mac.Sum(nil)
+}
+
+// hashPassword validates a link password and returns its bcrypt hash
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordBytes {
+		return "", domain.Invalid(fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes))
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", domain.Internal(fmt.Errorf("failed to hash password: %w", err))
+	}
+	return string(hash), nil
+}
+
+// randomSecret returns a random 32-byte signing key
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate secret: %v", err))
+	}
+	return secret
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+)
+
+func TestUnlockURL(t *testing.T) {
+	svc, _, cache := newTestService()
+	ctx := context.Background()
+
+	alias, password := "private", "s3cret"
+	_, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/doc",
+		CustomAlias: &alias,
+		Password:    &password,
+	}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if _, err := cache.Get(ctx, alias); err == nil {
+		t.Error("Expected protected links not to be cached")
+	}
+
+	if _, err := svc.GetOriginalURL(ctx, alias, &domain.Visit{}); !errors.Is(err, domain.ErrPasswordRequired) {
+		t.Fatalf("Expected ErrPasswordRequired, got %v", err)
+	}
+	if _, err := svc.UnlockURL(ctx, alias, "wrong"); !errors.Is(err, domain.ErrInvalidPassword) {
+		t.Fatalf("Expected ErrInvalidPassword, got %v", err)
+	}
+
+	resp, err := svc.UnlockURL(ctx, alias, password)
+	if err != nil {
+		t.Fatalf("UnlockURL returned error: %v", err)
+	}
+	if resp.ExpiresAt.After(time.Now().Add(defaultUnlockTTL)) {
+		t.Errorf("Expected the unlock to expire within %s, got %s", defaultUnlockTTL, resp.ExpiresAt)
+	}
+
+	dest, err := svc.GetOriginalURL(ctx, alias, &domain.Visit{UnlockToken: resp.Token})
+	if err != nil || dest.URL != "https://example.com/doc" {
+		t.Errorf("Expected the token to unlock the link, got %+v, %v", dest, err)
+	}
+
+	other, _ := NewURLService(svc.store, cache, testBaseURL).UnlockURL(ctx, alias, password)
+	if _, err := svc.GetOriginalURL(ctx, alias, &domain.Visit{UnlockToken: other.Token}); !errors.Is(err, domain.ErrPasswordRequired) {
+		t.Errorf("Expected tokens signed with another secret to be rejected, got %v", err)
+	}
+
+	expired := "1." + strings.SplitN(resp.Token, ".", 2)[1]
+	if _, err := svc.GetOriginalURL(ctx, alias, &domain.Visit{UnlockToken: expired}); !errors.Is(err, domain.ErrPasswordRequired) {
+		t.Errorf("Expected expired tokens to be rejected, got %v", err)
+	}
+
+	reused, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/doc", ReuseExisting: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if reused.Reused {
+		t.Error("Expected protected links not to be reused for public requests")
+	}
+}
+
+func TestUnlockURL_NotYetActive(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	alias, password := "preview", "s3cret"
+	activatesAt := time.Now().Add(time.Hour)
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/launch",
+		CustomAlias: &alias,
+		Password:    &password,
+		ActivatesAt: &activatesAt,
+	}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	resp, err := svc.UnlockURL(ctx, alias, password)
+	var appErr *domain.Error
+	if !errors.As(err, &appErr) || appErr.Code != domain.CodeNotYetActive {
+		t.Fatalf("Expected not_yet_active, got %+v, %v", resp, err)
+	}
+}
+
+func TestShortenURL_PasswordTooLong(t *testing.T) {
+	svc, _, _ := newTestService()
+
+	password := strings.Repeat("x", maxPasswordBytes+1)
+	_, err := svc.ShortenURL(context.Background(), &domain.CreateURLRequest{LongURL: "https://example.com", Password: &password}, "")
+
+	var appErr *domain.Error
+	if !errors.As(err, &appErr) || appErr.Code != "invalid_request" {
+		t.Errorf("Expected invalid_request, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"url-shortener/internal/domain"
+)
+
+// defaultPorts maps schemes to the port that is implied when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// idnaProfile converts host names like idna.Lookup but, like browsers, accepts
+// underscores and other characters outside the strict host name syntax
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// URLNormalizer computes the canonical form of destination URLs, under which
+// equivalent spellings of the same destination are stored and deduplicated
+type URLNormalizer struct {
+	stripParams   map[string]bool
+	stripPrefixes []string
+}
+
+// NewURLNormalizer creates a normalizer that removes the given query parameters,
+// typically tracking parameters such as utm_* or fbclid (matched
+// case-insensitively; a trailing * matches by prefix)
+func NewURLNormalizer(stripParams ...string) *URLNormalizer {
+	n := &URLNormalizer{stripParams: make(map[string]bool)}
+	for _, param := range stripParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		switch {
+		case param == "" || param == "*":
+		case strings.HasSuffix(param, "*"):
+			n.stripPrefixes = append(n.stripPrefixes, strings.TrimSuffix(param, "*"))
+		default:
+			n.stripParams[param] = true
+		}
+	}
+	return n
+}
+
+// Normalize returns the canonical form of rawURL: the scheme and host are
+// lowercased, IDNs converted to punycode, trailing dots and default ports
+// removed, percent-encoding made uniform, tracking parameters stripped and the
+// remaining query parameters sorted by name. An empty path becomes "/".
+func (n *URLNormalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", domain.URLRejected(ReasonInvalidURL, "invalid URL format")
+	}
+	scheme := strings.ToLower(u.Scheme)
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", domain.URLRejected(ReasonInvalidURL, "invalid URL host")
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(normalizeEscapes(u.User.String()))
+		b.WriteByte('@')
+	}
+	b.WriteString(host)
+
+	path := normalizeEscapes(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if query := n.normalizeQuery(u.RawQuery); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(u.EscapedFragment()))
+	}
+	return b.String(), nil
+}
+
+// normalizeQuery drops stripped and empty parameters from a raw query string
+// and sorts the rest by name, keeping the order of repeated names
+func (n *URLNormalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct{ name, pair string }
+	var params []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		pair = normalizeEscapes(pair)
+		rawName, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if n.stripped(name) {
+			continue
+		}
+		params = append(params, param{name: name, pair: pair})
+	}
+	sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.pair
+	}
+	return strings.Join(pairs, "&")
+}
+
+// stripped reports whether the query parameter name is on the strip list
+func (n *URLNormalizer) stripped(name string) bool {
+	name = strings.ToLower(name)
+	if n.stripParams[name] {
+		return true
+	}
+	for _, prefix := range n.stripPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalHost lowercases a host, strips a trailing dot and converts
+// internationalized domain names to their ASCII (punycode) form
+func canonicalHost(host string) (string, error) {
+	host = normalizeHost(host)
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	return idnaProfile.ToASCII(host)
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters, which never
+// need escaping, and uppercases the hex digits of all other escapes
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
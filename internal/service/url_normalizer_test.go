@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"url-shortener/internal/domain"
+)
+
+func TestURLNormalizer_Normalize(t *testing.T) {
+	normalizer := NewURLNormalizer("utm_*", "fbclid")
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/page", "https://example.com/page"},
+		{"https://My_Host.example.com/", "https://my_host.example.com/"},
+		{"HTTPS://Example.COM", "https://example.com/"},
+		{"https://example.com.:443/page", "https://example.com/page"},
+		{"http://example.com:80/", "http://example.com/"},
+		{"http://example.com:8080/", "http://example.com:8080/"},
+		{"https://bücher.example/straße", "https://xn--bcher-kva.example/stra%C3%9Fe"},
+		{"https://example.com/%7euser/a%2fb%3f", "https://example.com/~user/a%2Fb%3F"},
+		{"https://example.com/?b=2&a=1&a=0", "https://example.com/?a=1&a=0&b=2"},
+		{"https://example.com/?utm_source=x&id=7&UTM_Medium=y&fbclid=z", "https://example.com/?id=7"},
+		{"https://example.com/?utm_source=x", "https://example.com/"},
+		{"https://example.com/?q=a%2bb&&", "https://example.com/?q=a%2Bb"},
+		{"https://example.com/docs#Intro", "https://example.com/docs#Intro"},
+		{"http://[2001:DB8::1]:80/", "http://[2001:db8::1]/"},
+		{"http://[2001:db8::1]:8080/", "http://[2001:db8::1]:8080/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := normalizer.Normalize(tt.url)
+			if err != nil {
+				t.Fatalf("Normalize returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLNormalizer_KeepsParamsByDefault(t *testing.T) {
+	got, err := NewURLNormalizer().Normalize("https://example.com/?utm_source=x")
+	if err != nil {
+		t.Fatalf("Normalize returned error: %v", err)
+	}
+	if !strings.Contains(got, "utm_source=x") {
+		t.Errorf("Expected tracking parameters to be kept, got %q", got)
+	}
+}
+
+func TestShortenURL_Canonicalization(t *testing.T) {
+	svc, store, _ := newTestService()
+	svc.normalizer = NewURLNormalizer("utm_*")
+	ctx := context.Background()
+
+	longURL := "HTTPS://Example.com:443/page?utm_source=mail&b=2&a=1"
+	resp, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: longURL}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	stored, err := store.GetURLByShortCode(ctx, strings.TrimPrefix(resp.ShortURL, testBaseURL+"/"))
+	if err != nil {
+		t.Fatalf("GetURLByShortCode returned error: %v", err)
+	}
+	if stored.OriginalURL != longURL {
+		t.Errorf("Expected the submitted URL to be kept, got %q", stored.OriginalURL)
+	}
+	if want := "https://example.com/page?a=1&b=2"; stored.CanonicalURL != want {
+		t.Errorf("Expected canonical URL %q, got %q", want, stored.CanonicalURL)
+	}
+
+	reused, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/page?a=1&b=2&utm_campaign=x", ReuseExisting: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if !reused.Reused || reused.ShortURL != resp.ShortURL {
+		t.Errorf("Expected link %q to be reused, got %+v", resp.ShortURL, reused)
+	}
+
+	normalized, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: longURL, Normalize: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	stored, err = store.GetURLByShortCode(ctx, strings.TrimPrefix(normalized.ShortURL, testBaseURL+"/"))
+	if err != nil {
+		t.Fatalf("GetURLByShortCode returned error: %v", err)
+	}
+	if stored.OriginalURL != stored.CanonicalURL {
+		t.Errorf("Expected normalized link to redirect to %q, got %q", stored.CanonicalURL, stored.OriginalURL)
+	}
+}
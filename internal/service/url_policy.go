@@ -0,0 +1,265 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+
+	"url-shortener/internal/domain"
+)
+
+// Reason codes of destination URLs rejected by the URL policy
+const (
+	ReasonInvalidURL       = "invalid_url"
+	ReasonSchemeNotAllowed = "scheme_not_allowed"
+	ReasonSelfReference    = "self_reference"
+	ReasonPrivateAddress   = "private_address"
+	ReasonShortenerHost    = "shortener_host"
+	ReasonBlockedDomain    = "blocked_domain"
+)
+
+// DefaultAllowedSchemes are the URL schemes accepted unless configured otherwise
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// DefaultShortenerHosts are well-known URL shorteners; links to them are
+// rejected so that short links cannot be chained to hide their destination
+var DefaultShortenerHosts = []string{
+	"bit.ly", "bitly.com", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "ow.ly",
+	"rb.gy", "rebrand.ly", "shorturl.at", "t.co", "t.ly", "tiny.cc", "tinyurl.com", "v.gd",
+}
+
+// URLPolicy decides which destination URLs may be shortened. It enforces an
+// allow-list of schemes and rejects links back to this service, to other
+// shorteners, to private IP addresses and to blocklisted domains.
+type URLPolicy struct {
+	allowedSchemes map[string]bool
+	selfHost       string
+	shortenerHosts map[string]bool
+	blocklistPath  string
+
+	mu      sync.RWMutex
+	blocked map[string]bool
+}
+
+// PolicyOption configures optional URLPolicy behaviour
+type PolicyOption func(*URLPolicy)
+
+// WithAllowedSchemes replaces the allowed URL schemes (by default http and https)
+func WithAllowedSchemes(schemes ...string) PolicyOption {
+	return func(p *URLPolicy) {
+		p.allowedSchemes = toHostSet(schemes)
+	}
+}
+
+// WithShortenerHosts replaces the list of URL shortener domains that may not be
+// linked to (by default DefaultShortenerHosts)
+func WithShortenerHosts(hosts ...string) PolicyOption {
+	return func(p *URLPolicy) {
+		p.shortenerHosts = toHostSet(hosts)
+	}
+}
+
+// WithBlocklistFile loads blocked domains from a file with one domain per line;
+// blank lines and lines starting with # are ignored. See URLPolicy.Reload.
+func WithBlocklistFile(path string) PolicyOption {
+	return func(p *URLPolicy) {
+		p.blocklistPath = path
+	}
+}
+
+// NewURLPolicy creates a URL policy for a service reachable at baseURL and
+// loads the blocklist file, if one is configured
+func NewURLPolicy(baseURL string, opts ...PolicyOption) (*URLPolicy, error) {
+	p := &URLPolicy{
+		allowedSchemes: toHostSet(DefaultAllowedSchemes),
+		shortenerHosts: toHostSet(DefaultShortenerHosts),
+		blocked:        map[string]bool{},
+	}
+	if u, err := url.Parse(baseURL); err == nil {
+		p.selfHost = normalizeHost(u.Hostname())
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload re-reads the blocklist file, so the blocklist can be updated without
+// a restart. On error the previous blocklist stays in effect.
+func (p *URLPolicy) Reload() error {
+	if p.blocklistPath == "" {
+		return nil
+	}
+
+	f, err := os.Open(p.blocklistPath)
+	if err != nil {
+		return fmt.Errorf("failed to open blocklist: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	blocked := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocked[normalizeHost(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read blocklist: %w", err)
+	}
+
+	p.mu.Lock()
+	p.blocked = blocked
+	p.mu.Unlock()
+	return nil
+}
+
+// BlockedDomains returns the number of domains on the blocklist
+func (p *URLPolicy) BlockedDomains() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.blocked)
+}
+
+// Check returns a domain.URLRejected error naming the reason if rawURL may not
+// be shortened, and nil otherwise
+func (p *URLPolicy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return domain.URLRejected(ReasonInvalidURL, "invalid URL format")
+	}
+	if !p.allowedSchemes[strings.ToLower(u.Scheme)] {
+		return domain.URLRejected(ReasonSchemeNotAllowed, fmt.Sprintf("URL scheme %q is not allowed", u.Scheme))
+	}
+
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return domain.URLRejected(ReasonInvalidURL, "invalid URL format")
+	}
+	if p.selfHost != "" && host == p.selfHost {
+		return domain.URLRejected(ReasonSelfReference, "URL points back at this service")
+	}
+	if isPrivateHost(host) {
+		return domain.URLRejected(ReasonPrivateAddress, "URL points at a private or local address")
+	}
+	if matchesDomain(host, p.shortenerHosts) {
+		return domain.URLRejected(ReasonShortenerHost, "URL points at another URL shortener")
+	}
+
+	p.mu.RLock()
+	blocked := matchesDomain(host, p.blocked)
+	p.mu.RUnlock()
+	if blocked {
+		return domain.URLRejected(ReasonBlockedDomain, "URL domain is blocked")
+	}
+
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// net.IP.IsPrivate does not cover
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPrivateHost reports whether host is localhost or an IP literal in a
+// loopback, private, shared, link-local or unspecified range. Numeric IPv4
+// forms that browsers and resolvers accept, such as 127.1, 0177.0.0.1 or
+// 0x7f000001, count as IP literals.
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		if ip = parseInetAton(host); ip == nil {
+			return false
+		}
+	}
+
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// parseInetAton parses an IPv4 address the way inet_aton does: one to four
+// dot-separated parts, each decimal, octal (leading 0) or hex (leading 0x),
+// where the last part fills all remaining bytes. It returns nil if host is
+// not such an address.
+func parseInetAton(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	var n uint64
+	for i, part := range parts {
+		bits := 8
+		if i == len(parts)-1 {
+			bits = 8 * (4 - i)
+		}
+		base := 10
+		switch {
+		case len(part) > 2 && (part[:2] == "0x" || part[:2] == "0X"):
+			part, base = part[2:], 16
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+		if part == "" || part[0] == '+' {
+			return nil
+		}
+		v, err := strconv.ParseUint(part, base, bits)
+		if err != nil {
+			return nil
+		}
+		n = n<<bits | v
+	}
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// matchesDomain reports whether host or any of its parent domains is in set
+func matchesDomain(host string, set map[string]bool) bool {
+	for {
+		if set[host] {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+// normalizeHost lowercases a host name, converts internationalized names to
+// their punycode form and strips a trailing dot, so that every spelling of a
+// domain compares equal
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// toHostSet builds a lookup set of normalized names
+func toHostSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = normalizeHost(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"url-shortener/internal/domain"
+)
+
+func TestURLPolicy_Check(t *testing.T) {
+	policy, err := NewURLPolicy("https://sho.rt")
+	if err != nil {
+		t.Fatalf("NewURLPolicy returned error: %v", err)
+	}
+
+	tests := []struct {
+		url    string
+		reason string
+	}{
+		{"https://example.com/page", ""},
+		{"HTTP://Example.COM", ""},
+		{"https://8.8.8.8/", ""},
+		{"not-a-url", ReasonInvalidURL},
+		{"https://", ReasonInvalidURL},
+		{"javascript:alert(1)", ReasonSchemeNotAllowed},
+		{"data:text/html,<script>alert(1)</script>", ReasonSchemeNotAllowed},
+		{"file:///etc/passwd", ReasonSchemeNotAllowed},
+		{"ftp://example.com/file", ReasonSchemeNotAllowed},
+		{"https://sho.rt/abc", ReasonSelfReference},
+		{"https://SHO.RT./abc", ReasonSelfReference},
+		{"http://localhost:8080/admin", ReasonPrivateAddress},
+		{"http://127.0.0.1/", ReasonPrivateAddress},
+		{"http://10.1.2.3/", ReasonPrivateAddress},
+		{"http://192.168.0.1/", ReasonPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", ReasonPrivateAddress},
+		{"http://[::1]/", ReasonPrivateAddress},
+		{"http://[fd00::1]/", ReasonPrivateAddress},
+		{"http://2130706433/", ReasonPrivateAddress},
+		{"http://0x7f000001/", ReasonPrivateAddress},
+		{"http://127.1/", ReasonPrivateAddress},
+		{"http://0177.0.0.1/", ReasonPrivateAddress},
+		{"http://0x7f.1/", ReasonPrivateAddress},
+		{"http://012.0x10203/", ReasonPrivateAddress},
+		{"http://100.64.0.1/", ReasonPrivateAddress},
+		{"http://100.127.255.254/", ReasonPrivateAddress},
+		{"https://100.128.0.1/", ""},
+		{"https://1.2.3.4.5/", ""},
+		{"https://bit.ly/xyz", ReasonShortenerHost},
+		{"https://www.tinyurl.com/xyz", ReasonShortenerHost},
+		{"https://example.com@bit.ly/xyz", ReasonShortenerHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := policy.Check(tt.url)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("Expected %q to be allowed, got %v", tt.url, err)
+				}
+				return
+			}
+
+			var appErr *domain.Error
+			if !errors.As(err, &appErr) || appErr.Reason != tt.reason {
+				t.Errorf("Expected %q to be rejected with reason %q, got %v", tt.url, tt.reason, err)
+			}
+		})
+	}
+}
+
+func TestURLPolicy_Options(t *testing.T) {
+	policy, err := NewURLPolicy("https://sho.rt", WithAllowedSchemes("https", "mailto"), WithShortenerHosts("go.example"))
+	if err != nil {
+		t.Fatalf("NewURLPolicy returned error: %v", err)
+	}
+
+	if err := policy.Check("http://example.com"); err == nil {
+		t.Error("Expected http to be rejected when only https is allowed")
+	}
+	if err := policy.Check("https://bit.ly/xyz"); err != nil {
+		t.Errorf("Expected replaced shortener list to allow bit.ly, got %v", err)
+	}
+	if err := policy.Check("https://go.example/xyz"); err == nil {
+		t.Error("Expected configured shortener host to be rejected")
+	}
+}
+
+func TestURLPolicy_BlocklistReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# phishing\nevil.example\nbücher.example\n\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+
+	policy, err := NewURLPolicy("https://sho.rt", WithBlocklistFile(path))
+	if err != nil {
+		t.Fatalf("NewURLPolicy returned error: %v", err)
+	}
+
+	var appErr *domain.Error
+	if err := policy.Check("https://login.evil.example/"); !errors.As(err, &appErr) || appErr.Reason != ReasonBlockedDomain {
+		t.Errorf("Expected subdomain of a blocked domain to be rejected, got %v", err)
+	}
+	if err := policy.Check("https://notevil.example/"); err != nil {
+		t.Errorf("Expected unrelated domain to be allowed, got %v", err)
+	}
+	if err := policy.Check("https://ＥＶＩＬ.example/"); !errors.As(err, &appErr) || appErr.Reason != ReasonBlockedDomain {
+		t.Errorf("Expected a Unicode spelling of a blocked domain to be rejected, got %v", err)
+	}
+	if err := policy.Check("https://xn--bcher-kva.example/"); !errors.As(err, &appErr) || appErr.Reason != ReasonBlockedDomain {
+		t.Errorf("Expected the punycode spelling of a blocked domain to be rejected, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("notevil.example\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	if err := policy.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	if err := policy.Check("https://login.evil.example/"); err != nil {
+		t.Errorf("Expected domain removed from the blocklist to be allowed, got %v", err)
+	}
+	if err := policy.Check("https://notevil.example/"); err == nil {
+		t.Error("Expected newly blocked domain to be rejected")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	if err := policy.Reload(); err == nil {
+		t.Error("Expected error reloading a missing blocklist")
+	}
+	if policy.BlockedDomains() != 1 {
+		t.Errorf("Expected previous blocklist to stay in effect, got %d domains", policy.BlockedDomains())
+	}
+
+	if _, err := NewURLPolicy("https://sho.rt", WithBlocklistFile(path)); err == nil {
+		t.Error("Expected error for a missing blocklist file")
+	}
+}
@@ -2,173 +2,1031 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"net/url"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"url-shortener/internal/domain"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/repository"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Page size bounds for URL listings
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
+// defaultMaxBatchSize is the default cap on URLs created by one ShortenURLs call
+const defaultMaxBatchSize = 1000
+
+// maxCodeAttempts bounds how often generated short codes that are already in
+// use are replaced before link creation fails
+const maxCodeAttempts = 5
+
+// maxTitleLength bounds the title of a link, in characters
+const maxTitleLength = 200
+
 // URLService handles business logic for URL operations
 type URLService struct {
-	pgRepo    *repository.PostgresRepository
-	redisRepo *repository.RedisRepository
-	baseURL   string
+	store      repository.URLStore
+	cache      repository.URLCache
+	baseURL    string
+	ipHashSalt string
+	clicks     *ClickAggregator
+	codes      CodeGenerator
+	policy     *URLPolicy
+	normalizer *URLNormalizer
+	countries  CountryLookup
+	metrics    *metrics.Metrics
+
+	maxBatchSize int
+	unlockSecret []byte
+	unlockTTL    time.Duration
+}
+
+// Option configures optional URLService behaviour
+type Option func(*URLService)
+
+// WithIPHashSalt sets the salt mixed into client IPs before they are hashed for click analytics
+func WithIPHashSalt(salt string) Option {
+	return func(s *URLService) {
+		s.ipHashSalt = salt
+	}
 }
 
-// NewURLService creates a new URL service
-func NewURLService(pgRepo *repository.PostgresRepository, redisRepo *repository.RedisRepository, baseURL string) *URLService {
-	return &URLService{
-		pgRepo:    pgRepo,
-		redisRepo: redisRepo,
-		baseURL:   baseURL,
+// WithClickAggregator buffers clicks in the given aggregator instead of
+// writing each one to the store as it happens
+func WithClickAggregator(clicks *ClickAggregator) Option {
+	return func(s *URLService) {
+		s.clicks = clicks
 	}
 }
 
-// ShortenURL creates a shortened URL
-func (s *URLService) ShortenURL(ctx context.Context, req *domain.CreateURLRequest) (*domain.CreateURLResponse, error) {
-	// Validate URL format
-	if !isValidURL(req.LongURL) {
-		return nil, fmt.Errorf("invalid URL format")
+// WithMaxBatchSize caps how many URLs ShortenURLs creates in one call
+func WithMaxBatchSize(n int) Option {
+	return func(s *URLService) {
+		if n > 0 {
+			s.maxBatchSize = n
+		}
 	}
+}
 
-	var shortCode string
-	var expiresAt *time.Time
+// WithCodeGenerator sets the generator of short codes for links without a
+// custom alias (by default sequential Base62 IDs)
+func WithCodeGenerator(codes CodeGenerator) Option {
+	return func(s *URLService) {
+		s.codes = codes
+	}
+}
 
-	// Calculate expiration time if TTL is provided
-	if req.TTLDays != nil && *req.TTLDays > 0 {
-		expiry := time.Now().Add(time.Duration(*req.TTLDays) * 24 * time.Hour)
-		expiresAt = &expiry
+// WithURLPolicy sets the policy destination URLs are checked against (by
+// default the allowed schemes and host rules of NewURLPolicy, without blocklist)
+func WithURLPolicy(policy *URLPolicy) Option {
+	return func(s *URLService) {
+		s.policy = policy
 	}
+}
 
-	// Handle custom alias
-	if req.CustomAlias != nil && *req.CustomAlias != "" {
-		// Validate custom alias (alphanumeric only, 3-20 chars)
-		if !isValidCustomAlias(*req.CustomAlias) {
-			return nil, fmt.Errorf("invalid custom alias: must be 3-20 alphanumeric characters")
+// WithURLNormalizer sets the normalizer that computes canonical destination
+// URLs (by default one that strips no query parameters)
+func WithURLNormalizer(normalizer *URLNormalizer) Option {
+	return func(s *URLService) {
+		s.normalizer = normalizer
+	}
+}
+
+// WithUnlockTokens sets the secret that signs the tokens unlocking
+// password-protected links and how long they stay valid. By default a random
+// secret is used, so tokens do not survive restarts or work across replicas.
+func WithUnlockTokens(secret []byte, ttl time.Duration) Option {
+	return func(s *URLService) {
+		if len(secret) > 0 {
+			s.unlockSecret = secret
+		}
+		if ttl > 0 {
+			s.unlockTTL = ttl
 		}
+	}
+}
+
+// WithCountryLookup sets the GeoIP lookup that resolves visitors' countries for
+// redirect rules. Without one, rules with a country condition never match.
+func WithCountryLookup(countries CountryLookup) Option {
+	return func(s *URLService) {
+		s.countries = countries
+	}
+}
+
+// WithMetrics records cache hits and misses and created links in m
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *URLService) {
+		s.metrics = m
+	}
+}
+
+// NewURLService creates a new URL service backed by the given store and cache
+func NewURLService(store repository.URLStore, cache repository.URLCache, baseURL string, opts ...Option) *URLService {
+	s := &URLService{
+		store:        store,
+		cache:        cache,
+		baseURL:      baseURL,
+		codes:        NewSequentialGenerator(store, 0),
+		normalizer:   NewURLNormalizer(),
+		maxBatchSize: defaultMaxBatchSize,
+		unlockSecret: randomSecret(),
+		unlockTTL:    defaultUnlockTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.policy == nil {
+		// Without a blocklist file there is nothing that can fail to load
+		s.policy, _ = NewURLPolicy(baseURL)
+	}
+	return s
+}
+
+// ShortenURL creates a shortened URL owned by ownerID (empty for anonymous links)
+func (s *URLService) ShortenURL(ctx context.Context, req *domain.CreateURLRequest, ownerID string) (*domain.CreateURLResponse, error) {
+	ctx, span := startSpan(ctx, "ShortenURL")
+	defer span.End()
+
+	urlEntity, err := s.newURL(req, ownerID)
+	if err != nil {
+		return nil, err
+	}
 
+	if reusable(req, ownerID) {
+		existing, err := s.store.FindURLsByCanonicalURL(ctx, ownerID, []string{urlEntity.CanonicalURL})
+		if err != nil {
+			return nil, domain.Internal(fmt.Errorf("failed to find existing URL: %w", err))
+		}
+		if found, ok := existing[urlEntity.CanonicalURL]; ok {
+			resp := s.createResponse(found)
+			resp.Reused = true
+			return resp, nil
+		}
+	}
+
+	if urlEntity.ShortCode != "" {
 		// Check if custom alias already exists
-		exists, err := s.pgRepo.CheckShortCodeExists(ctx, *req.CustomAlias)
+		exists, err := s.store.CheckShortCodeExists(ctx, urlEntity.ShortCode)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check custom alias: %w", err)
+			return nil, domain.Internal(fmt.Errorf("failed to check custom alias: %w", err))
 		}
 		if exists {
-			return nil, fmt.Errorf("custom alias already exists")
+			return nil, domain.ErrAliasTaken
 		}
-
-		shortCode = *req.CustomAlias
 	} else {
-		// Generate short code using Base62 encoding
-		id, err := s.pgRepo.GetNextID(ctx)
+		codes, err := s.generateCodes(ctx, 1, nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate ID: %w", err)
+			return nil, domain.Internal(fmt.Errorf("failed to generate short code: %w", err))
 		}
-		shortCode = Encode(id)
+		urlEntity.ShortCode = codes[0]
 	}
 
-	// Create URL entity
-	urlEntity := &domain.URL{
-		ShortCode:   shortCode,
-		OriginalURL: req.LongURL,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   expiresAt,
+	// Save to database
+	if err := s.store.CreateURL(ctx, urlEntity); err != nil {
+		return nil, domain.Internal(fmt.Errorf("failed to create URL: %w", err))
 	}
+	s.metrics.LinksCreated(1)
 
-	// Save to database
-	err := s.pgRepo.CreateURL(ctx, urlEntity)
+	// Cache in Redis (unless every redirect has to go through the store)
+	if ttl, ok := cacheTTL(urlEntity, time.Now()); ok {
+		if err := s.cache.Set(ctx, urlEntity.ShortCode, urlEntity.Redirect(), ttl); err != nil {
+			// Log error but don't fail the request
+			slog.WarnContext(logging.WithShortCode(ctx, urlEntity.ShortCode), "Failed to cache URL in Redis", "error", err)
+		}
+	}
+
+	return s.createResponse(urlEntity), nil
+}
+
+// ShortenURLs creates several shortened URLs owned by ownerID. Each request is
+// validated like in ShortenURL and failures are reported per item; the valid
+// ones are created in a single transaction and pre-warmed in the cache.
+// Results are returned in request order.
+func (s *URLService) ShortenURLs(ctx context.Context, reqs []*domain.CreateURLRequest, ownerID string) ([]domain.BatchCreateResult, error) {
+	ctx, span := startSpan(ctx, "ShortenURLs", attribute.Int("batch_size", len(reqs)))
+	defer span.End()
+
+	if len(reqs) == 0 {
+		return nil, domain.Invalid("at least one URL is required")
+	}
+	if len(reqs) > s.maxBatchSize {
+		return nil, domain.Invalid(fmt.Sprintf("at most %d URLs can be created at once", s.maxBatchSize))
+	}
+
+	results := make([]domain.BatchCreateResult, len(reqs))
+	urls := make([]*domain.URL, len(reqs))
+	aliases := make(map[string]int)
+	generated := 0
+
+	var reuse []string
+	for i, req := range reqs {
+		urlEntity, err := s.newURL(req, ownerID)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		urls[i] = urlEntity
+		if reusable(req, ownerID) {
+			reuse = append(reuse, urlEntity.CanonicalURL)
+		}
+	}
+	existing := map[string]*domain.URL{}
+	if len(reuse) > 0 {
+		var err error
+		existing, err = s.store.FindURLsByCanonicalURL(ctx, ownerID, reuse)
+		if err != nil {
+			return nil, domain.Internal(fmt.Errorf("failed to find existing URLs: %w", err))
+		}
+	}
+
+	for i, req := range reqs {
+		urlEntity := urls[i]
+		if urlEntity == nil {
+			continue
+		}
+
+		if found, ok := existing[urlEntity.CanonicalURL]; ok && reusable(req, ownerID) {
+			urls[i] = nil
+			results[i].Response = s.createResponse(found)
+			results[i].Response.Reused = true
+			continue
+		}
+
+		if urlEntity.ShortCode == "" {
+			generated++
+		} else if _, dup := aliases[urlEntity.ShortCode]; dup {
+			urls[i] = nil
+			results[i].Err = domain.ErrAliasTaken
+		} else {
+			aliases[urlEntity.ShortCode] = i
+		}
+	}
+
+	if len(aliases) > 0 {
+		codes := make([]string, 0, len(aliases))
+		for code := range aliases {
+			codes = append(codes, code)
+		}
+
+		existing, err := s.store.FindExistingShortCodes(ctx, codes)
+		if err != nil {
+			return nil, domain.Internal(fmt.Errorf("failed to check custom aliases: %w", err))
+		}
+		for _, code := range existing {
+			i := aliases[code]
+			urls[i] = nil
+			results[i].Err = domain.ErrAliasTaken
+		}
+	}
+
+	if generated > 0 {
+		codes, err := s.generateCodes(ctx, generated, aliases)
+		if err != nil {
+			return nil, domain.Internal(fmt.Errorf("failed to generate short codes: %w", err))
+		}
+		for _, urlEntity := range urls {
+			if urlEntity != nil && urlEntity.ShortCode == "" {
+				urlEntity.ShortCode = codes[0]
+				codes = codes[1:]
+			}
+		}
+	}
+
+	now := time.Now()
+	pending := make([]*domain.URL, 0, len(urls))
+	entries := make([]repository.CacheEntry, 0, len(urls))
+	for _, urlEntity := range urls {
+		if urlEntity == nil {
+			continue
+		}
+		pending = append(pending, urlEntity)
+		if ttl, ok := cacheTTL(urlEntity, now); ok {
+			entries = append(entries, repository.CacheEntry{
+				ShortCode: urlEntity.ShortCode,
+				Redirect:  urlEntity.Redirect(),
+				TTL:       ttl,
+			})
+		}
+	}
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	if err := s.store.CreateURLs(ctx, pending); err != nil {
+		return nil, domain.Internal(fmt.Errorf("failed to create URLs: %w", err))
+	}
+	s.metrics.LinksCreated(len(pending))
+
+	if err := s.cache.SetMany(ctx, entries); err != nil {
+		slog.WarnContext(ctx, "Failed to pre-warm cache", "urls", len(entries), "error", err)
+	}
+
+	for i, urlEntity := range urls {
+		if urlEntity != nil {
+			results[i].Response = s.createResponse(urlEntity)
+		}
+	}
+	return results, nil
+}
+
+// MaxBatchSize returns the most URLs ShortenURLs accepts in one call
+func (s *URLService) MaxBatchSize() int {
+	return s.maxBatchSize
+}
+
+// newURL validates a create request and builds the URL it describes. The short
+// code is only set for custom aliases; availability is checked by the caller.
+func (s *URLService) newURL(req *domain.CreateURLRequest, ownerID string) (*domain.URL, error) {
+	longURL := req.LongURL
+	if longURL == "" && len(req.Variants) > 0 {
+		longURL = req.Variants[0].TargetURL
+	}
+	originalURL, canonicalURL, err := s.destination(longURL, req.Normalize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create URL: %w", err)
+		return nil, err
+	}
+
+	urlEntity := &domain.URL{
+		OriginalURL:  originalURL,
+		CanonicalURL: canonicalURL,
+		CreatedAt:    time.Now(),
+		ActivatesAt:  utcTime(req.ActivatesAt),
+	}
+
+	// Calculate expiration time from the TTL or take the absolute one
+	if req.ExpiresAt != nil && req.TTLDays != nil {
+		return nil, domain.Invalid("expires_at and ttl_days are mutually exclusive")
+	}
+	if req.TTLDays != nil && *req.TTLDays > 0 {
+		expiry := time.Now().UTC().Add(time.Duration(*req.TTLDays) * 24 * time.Hour)
+		urlEntity.ExpiresAt = &expiry
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, domain.Invalid("expires_at must be in the future")
+		}
+		urlEntity.ExpiresAt = utcTime(req.ExpiresAt)
+	}
+	if err := validateSchedule(urlEntity); err != nil {
+		return nil, err
+	}
+
+	// Validate custom alias (alphanumeric only, 3-20 chars)
+	if req.CustomAlias != nil && *req.CustomAlias != "" {
+		if !isValidCustomAlias(*req.CustomAlias) {
+			return nil, domain.Invalid("invalid custom alias: must be 3-20 alphanumeric characters")
+		}
+		urlEntity.ShortCode = *req.CustomAlias
+	}
+
+	if req.MaxClicks != nil {
+		if *req.MaxClicks <= 0 {
+			return nil, domain.Invalid("max_clicks must be positive")
+		}
+		urlEntity.MaxClicks = req.MaxClicks
+	}
+
+	if req.Password != nil && *req.Password != "" {
+		hash, err := hashPassword(*req.Password)
+		if err != nil {
+			return nil, err
+		}
+		urlEntity.PasswordHash = &hash
+	}
+
+	if len(req.Rules) > 0 {
+		rules, err := s.compileRules(req.Rules, req.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		urlEntity.Rules = rules
 	}
 
-	// Cache in Redis
-	cacheTTL := 24 * time.Hour // Default cache TTL
-	if expiresAt != nil {
-		cacheTTL = time.Until(*expiresAt)
+	if len(req.Variants) > 0 {
+		variants, err := s.compileVariants(req.Variants, req.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		urlEntity.Variants = variants
+	}
+
+	urlEntity.ForwardPath = req.ForwardPath
+	urlEntity.ForwardQuery = req.ForwardQuery
+
+	urlEntity.RedirectType = domain.RedirectFound
+	if req.RedirectType != "" {
+		if !req.RedirectType.IsValid() {
+			return nil, invalidRedirectType()
+		}
+		urlEntity.RedirectType = req.RedirectType
+	}
+	if urlEntity.Title, err = validTitle(req.Title); err != nil {
+		return nil, err
 	}
 
-	err = s.redisRepo.Set(ctx, shortCode, req.LongURL, cacheTTL)
+	if ownerID != "" {
+		urlEntity.UserID = &ownerID
+	}
+
+	return urlEntity, nil
+}
+
+// destination checks a long URL against the URL policy and returns the URL to
+// redirect to (as submitted, unless normalize is set) and its canonical form
+func (s *URLService) destination(longURL string, normalize bool) (string, string, error) {
+	if err := s.policy.Check(longURL); err != nil {
+		return "", "", err
+	}
+
+	canonicalURL, err := s.normalizer.Normalize(longURL)
 	if err != nil {
-		// Log error but don't fail the request
-		log.Printf("Failed to cache URL in Redis: %v", err)
+		return "", "", err
+	}
+	if normalize {
+		return canonicalURL, canonicalURL, nil
+	}
+	return longURL, canonicalURL, nil
+}
+
+// generateCodes returns n distinct short codes from the code generator,
+// skipping codes that are already in use, reserved or keys of exclude
+func (s *URLService) generateCodes(ctx context.Context, n int, exclude map[string]int) ([]string, error) {
+	codes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+
+	for attempt := 0; attempt < maxCodeAttempts && len(codes) < n; attempt++ {
+		candidates, err := s.codes.Generate(ctx, n-len(codes))
+		if err != nil {
+			return nil, err
+		}
+
+		existing, err := s.store.FindExistingShortCodes(ctx, candidates)
+		if err != nil {
+			return nil, err
+		}
+		taken := make(map[string]bool, len(existing))
+		for _, code := range existing {
+			taken[code] = true
+		}
+
+		for _, code := range candidates {
+			_, excluded := exclude[code]
+			if taken[code] || seen[code] || excluded || reservedAliases[strings.ToLower(code)] {
+				continue
+			}
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+
+	if len(codes) < n {
+		return nil, fmt.Errorf("no unused short code found after %d attempts", maxCodeAttempts)
+	}
+	return codes, nil
+}
+
+// reusable reports whether req may be answered with an existing link. Only
+// plain 302 links of an authenticated owner without a custom alias, password,
+// click limit, activation or expiry time, redirect rules, variants, forwarding
+// or title are reused.
+func reusable(req *domain.CreateURLRequest, ownerID string) bool {
+	return req.ReuseExisting && ownerID != "" &&
+		(req.CustomAlias == nil || *req.CustomAlias == "") &&
+		(req.Password == nil || *req.Password == "") &&
+		req.MaxClicks == nil && req.ActivatesAt == nil && req.ExpiresAt == nil && req.TTLDays == nil &&
+		len(req.Rules) == 0 && len(req.Variants) == 0 &&
+		!req.ForwardPath && !req.ForwardQuery &&
+		(req.RedirectType == "" || req.RedirectType == domain.RedirectFound) && req.Title == ""
+}
+
+// invalidRedirectType is the error for unsupported redirect types
+func invalidRedirectType() error {
+	return domain.Invalid("redirect_type must be 301, 302, 307, 308 or interstitial")
+}
+
+// validTitle trims a link title and checks its length
+func validTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return "", domain.Invalid(fmt.Sprintf("title must be at most %d characters", maxTitleLength))
 	}
+	return title, nil
+}
 
-	// Build response
-	shortURL := fmt.Sprintf("%s/%s", s.baseURL, shortCode)
+// createResponse builds the API response for a newly created URL
+func (s *URLService) createResponse(urlEntity *domain.URL) *domain.CreateURLResponse {
 	return &domain.CreateURLResponse{
-		ShortURL:  shortURL,
-		ExpiresAt: expiresAt,
-	}, nil
+		ShortURL:  fmt.Sprintf("%s/%s", s.baseURL, urlEntity.ShortCode),
+		ExpiresAt: urlEntity.ExpiresAt,
+	}
+}
+
+// utcTime returns t converted to UTC. The urls table stores times without a
+// time zone, so times with another offset would be read back shifted.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// validateSchedule checks that a URL with both an activation and an expiry
+// time expires after it activates
+func validateSchedule(urlEntity *domain.URL) error {
+	if urlEntity.ActivatesAt != nil && urlEntity.ExpiresAt != nil && !urlEntity.ExpiresAt.After(*urlEntity.ActivatesAt) {
+		return domain.Invalid("expires_at must be after activates_at")
+	}
+	return nil
+}
+
+// cacheTTL returns how long redirects for a URL may be served from the cache:
+// until it expires, so the cache entry ends with the link, or a day for links
+// without expiry. ok is false for links that must not be cached at all:
+// protected and click-limited links must reach the store on every redirect,
+// and links that are not active yet (or no longer) must not be served.
+func cacheTTL(urlEntity *domain.URL, now time.Time) (ttl time.Duration, ok bool) {
+	if urlEntity.IsProtected() || urlEntity.IsClickLimited() || urlEntity.IsPending(now) {
+		return 0, false
+	}
+	if urlEntity.ExpiresAt == nil {
+		return 24 * time.Hour, true // Default cache TTL
+	}
+	ttl = urlEntity.ExpiresAt.Sub(now)
+	return ttl, ttl > 0
+}
+
+// GetOriginalURL retrieves the destination of a short code (cache-first) and
+// records the visit in the click log. The destination is the target of the
+// first redirect rule matching the visit, else the A/B variant assigned to the
+// visitor, else the original URL, with the visited path and query passed
+// through if the link forwards them. visit may be nil. It returns
+// domain.ErrNotFound (also for a visit with a path to a link that does not
+// forward it), domain.ErrExpired or domain.ErrDisabled when the short
+// code cannot be resolved, a domain.NotYetActive error before a scheduled
+// link's activation time, domain.ErrPasswordRequired for protected links
+// unless the visit carries a valid unlock token, and domain.ErrClickLimitReached
+// once a click-limited link has been used up.
+func (s *URLService) GetOriginalURL(ctx context.Context, shortCode string, visit *domain.Visit) (*domain.Destination, error) {
+	ctx, span := startSpan(logging.WithShortCode(ctx, shortCode), "GetOriginalURL", shortCodeAttr(shortCode))
+	defer span.End()
+
+	dest, err := s.lookupDestination(ctx, shortCode, visit, true)
+	if err != nil {
+		return nil, err
+	}
+	s.recordClick(ctx, s.newClickEvent(shortCode, visit, dest))
+	return dest, nil
+}
+
+// PreviewURL retrieves the destination of a short code like GetOriginalURL,
+// with the same errors, for showing it without following the link: no click
+// is recorded and click-limited links are not used up.
+func (s *URLService) PreviewURL(ctx context.Context, shortCode string, visit *domain.Visit) (*domain.Destination, error) {
+	ctx, span := startSpan(logging.WithShortCode(ctx, shortCode), "PreviewURL", shortCodeAttr(shortCode))
+	defer span.End()
+
+	return s.lookupDestination(ctx, shortCode, visit, false)
 }
 
-// GetOriginalURL retrieves the original URL for a short code (cache-first)
-func (s *URLService) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
+// lookupDestination resolves a visit to a short code, from the cache if
+// possible. If follow is set, a click of click-limited links is consumed.
+func (s *URLService) lookupDestination(ctx context.Context, shortCode string, visit *domain.Visit, follow bool) (*domain.Destination, error) {
 	// Try cache first
-	originalURL, err := s.redisRepo.Get(ctx, shortCode)
+	redirect, err := s.cache.Get(ctx, shortCode)
 	if err == nil {
-		log.Printf("Cache hit for short code: %s", shortCode)
-		// Asynchronously increment click count
-		go s.incrementClickCountAsync(shortCode)
-		return originalURL, nil
+		slog.DebugContext(ctx, "Cache hit")
+		s.metrics.CacheHit()
+		if !forwards(redirect, visit) {
+			return nil, domain.ErrNotFound
+		}
+		return s.resolveRedirect(ctx, shortCode, redirect, visit, time.Now()), nil
 	}
 
-	log.Printf("Cache miss for short code: %s", shortCode)
+	slog.DebugContext(ctx, "Cache miss")
+	s.metrics.CacheMiss()
 
 	// Fallback to database
-	urlEntity, err := s.pgRepo.GetURLByShortCode(ctx, shortCode)
+	urlEntity, err := s.store.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
-		return "", fmt.Errorf("URL not found")
+		return nil, lookupError(err)
+	}
+	redirect = urlEntity.Redirect()
+	if !forwards(redirect, visit) {
+		return nil, domain.ErrNotFound
+	}
+	if urlEntity.Disabled {
+		return nil, domain.ErrDisabled
+	}
+	now := time.Now()
+	if urlEntity.IsExpired(now) {
+		return nil, domain.ErrExpired
+	}
+	if urlEntity.IsPending(now) {
+		return nil, domain.NotYetActive(*urlEntity.ActivatesAt)
+	}
+	if urlEntity.IsProtected() && (visit == nil || !s.validUnlockToken(urlEntity, visit.UnlockToken)) {
+		return nil, domain.ErrPasswordRequired
+	}
+	if urlEntity.IsClickLimited() {
+		if !follow {
+			if urlEntity.ClicksUsed >= *urlEntity.MaxClicks {
+				return nil, domain.ErrClickLimitReached
+			}
+		} else if err := s.consumeClick(ctx, shortCode); err != nil {
+			return nil, err
+		}
 	}
 
 	// Populate cache for future requests
-	cacheTTL := 24 * time.Hour
-	if urlEntity.ExpiresAt != nil {
-		cacheTTL = time.Until(*urlEntity.ExpiresAt)
+	if ttl, ok := cacheTTL(urlEntity, now); ok {
+		err = s.cache.Set(ctx, shortCode, redirect, ttl)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to populate cache", "error", err)
+		}
 	}
 
-	err = s.redisRepo.Set(ctx, shortCode, urlEntity.OriginalURL, cacheTTL)
+	return s.resolveRedirect(ctx, shortCode, redirect, visit, now), nil
+}
+
+// resolveRedirect decides where a visit to shortCode at now goes: to the
+// first matching rule's target, else to the visitor's A/B variant, else to
+// the redirect's URL; forwarding then applies to whichever was chosen
+func (s *URLService) resolveRedirect(ctx context.Context, shortCode string, redirect *domain.Redirect, visit *domain.Visit, now time.Time) *domain.Destination {
+	dest := &domain.Destination{URL: redirect.URL, Type: redirect.Type, Title: redirect.Title}
+	if target, ok := s.matchRule(ctx, redirect.Rules, visit, now); ok {
+		dest.URL = target
+	} else if len(redirect.Variants) > 0 {
+		variant := s.assignVariant(shortCode, redirect.Variants, visit)
+		dest.URL, dest.Variant = variant.TargetURL, variant.Name
+	}
+	dest.URL = forward(dest.URL, redirect, visit)
+	return dest
+}
+
+// consumeClick uses up one click of a click-limited link. Clicks are counted
+// atomically in the store, so concurrent redirects cannot exceed the limit;
+// the link is evicted from the cache as soon as it is used up.
+func (s *URLService) consumeClick(ctx context.Context, shortCode string) error {
+	remaining, ok, err := s.store.ConsumeClick(ctx, shortCode)
 	if err != nil {
-		log.Printf("Failed to populate cache: %v", err)
+		return domain.Internal(fmt.Errorf("failed to consume click: %w", err))
+	}
+	if !ok || remaining == 0 {
+		s.invalidateCache(ctx, shortCode)
+	}
+	if !ok {
+		return domain.ErrClickLimitReached
 	}
+	return nil
+}
 
-	// Asynchronously increment click count
-	go s.incrementClickCountAsync(shortCode)
+// GetURL retrieves the details of a short URL owned by ownerID, including expired ones
+func (s *URLService) GetURL(ctx context.Context, shortCode, ownerID string) (*domain.URL, error) {
+	ctx, span := startSpan(ctx, "GetURL", shortCodeAttr(shortCode))
+	defer span.End()
 
-	return urlEntity.OriginalURL, nil
+	return s.getOwnedURL(ctx, shortCode, ownerID)
 }
 
-// GetAnalytics retrieves analytics for a short code
-func (s *URLService) GetAnalytics(ctx context.Context, shortCode string) (*domain.Analytics, error) {
-	analytics, err := s.pgRepo.GetAnalytics(ctx, shortCode)
+// UpdateURL changes the destination, activation window, redirect rules, A/B
+// variants, forwarding, redirect type, title and/or disabled flag of a short URL and invalidates its cache entry
+func (s *URLService) UpdateURL(ctx context.Context, shortCode, ownerID string, req *domain.UpdateURLRequest) (*domain.URL, error) {
+	ctx, span := startSpan(ctx, "UpdateURL", shortCodeAttr(shortCode))
+	defer span.End()
+
+	if req.ExpiresAt != nil && req.TTLDays != nil {
+		return nil, domain.Invalid("expires_at and ttl_days are mutually exclusive")
+	}
+
+	urlEntity, err := s.getOwnedURL(ctx, shortCode, ownerID)
 	if err != nil {
-		return nil, fmt.Errorf("analytics not found")
+		return nil, err
+	}
+
+	if req.LongURL != nil {
+		originalURL, canonicalURL, err := s.destination(*req.LongURL, req.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		urlEntity.OriginalURL = originalURL
+		urlEntity.CanonicalURL = canonicalURL
+	}
+
+	if req.TTLDays != nil {
+		if *req.TTLDays <= 0 {
+			return nil, domain.Invalid("ttl_days must be positive")
+		}
+		expiry := time.Now().UTC().Add(time.Duration(*req.TTLDays) * 24 * time.Hour)
+		urlEntity.ExpiresAt = &expiry
+	}
+
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, domain.Invalid("expires_at must be in the future")
+		}
+		urlEntity.ExpiresAt = utcTime(req.ExpiresAt)
+	}
+
+	if req.ActivatesAt != nil {
+		urlEntity.ActivatesAt = utcTime(req.ActivatesAt)
+	}
+	if err := validateSchedule(urlEntity); err != nil {
+		return nil, err
+	}
+
+	if req.Rules != nil {
+		rules, err := s.compileRules(*req.Rules, req.Normalize)
+		if err != nil {
+			return nil, err
+		}
+		urlEntity.Rules = rules
+	}
+
+	if req.Variants != nil {
+		urlEntity.Variants = nil
+		if len(*req.Variants) > 0 {
+			variants, err := s.compileVariants(*req.Variants, req.Normalize)
+			if err != nil {
+				return nil, err
+			}
+			urlEntity.Variants = variants
+		}
+	}
+
+	if req.ForwardPath != nil {
+		urlEntity.ForwardPath = *req.ForwardPath
+	}
+	if req.ForwardQuery != nil {
+		urlEntity.ForwardQuery = *req.ForwardQuery
+	}
+
+	if req.RedirectType != nil {
+		if !req.RedirectType.IsValid() {
+			return nil, invalidRedirectType()
+		}
+		urlEntity.RedirectType = *req.RedirectType
+	}
+	if req.Title != nil {
+		if urlEntity.Title, err = validTitle(*req.Title); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Disabled != nil {
+		urlEntity.Disabled = *req.Disabled
+	}
+
+	if err := s.store.UpdateURL(ctx, urlEntity); err != nil {
+		return nil, domain.Internal(fmt.Errorf("failed to update URL: %w", err))
 	}
+
+	s.invalidateCache(ctx, shortCode)
+	return urlEntity, nil
+}
+
+// DeleteURL removes a short URL owned by ownerID and invalidates its cache entry
+func (s *URLService) DeleteURL(ctx context.Context, shortCode, ownerID string) error {
+	ctx, span := startSpan(ctx, "DeleteURL", shortCodeAttr(shortCode))
+	defer span.End()
+
+	if _, err := s.getOwnedURL(ctx, shortCode, ownerID); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteURL(ctx, shortCode); err != nil {
+		return lookupError(err)
+	}
+
+	s.invalidateCache(ctx, shortCode)
+	return nil
+}
+
+// ListURLs retrieves a page of the short URLs owned by ownerID. cursor is the
+// next_cursor of the previous page, or empty for the first page.
+func (s *URLService) ListURLs(ctx context.Context, ownerID string, filter domain.URLFilter, cursor string) (*domain.URLPage, error) {
+	ctx, span := startSpan(ctx, "ListURLs")
+	defer span.End()
+
+	if ownerID == "" {
+		return nil, domain.ErrUnauthorized
+	}
+	filter.OwnerID = ownerID
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+
+	if cursor != "" {
+		beforeID, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.BeforeID = beforeID
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	pageSize := filter.Limit
+	filter.Limit++
+	urls, err := s.store.ListURLs(ctx, filter)
+	if err != nil {
+		return nil, domain.Internal(fmt.Errorf("failed to list URLs: %w", err))
+	}
+
+	page := &domain.URLPage{URLs: urls}
+	if len(urls) > pageSize {
+		page.URLs = urls[:pageSize]
+		page.NextCursor = encodeCursor(page.URLs[pageSize-1].ID)
+	}
+	return page, nil
+}
+
+// GetAnalytics retrieves analytics for a short code owned by ownerID, including
+// a click time series bucketed according to the query
+func (s *URLService) GetAnalytics(ctx context.Context, shortCode, ownerID string, query domain.AnalyticsQuery) (*domain.Analytics, error) {
+	ctx, span := startSpan(ctx, "GetAnalytics", shortCodeAttr(shortCode))
+	defer span.End()
+
+	if err := query.Normalize(time.Now()); err != nil {
+		return nil, domain.Invalid(err.Error())
+	}
+
+	urlEntity, err := s.getOwnedURL(ctx, shortCode, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics, err := s.store.GetAnalytics(ctx, shortCode)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	points, err := s.store.GetClickTimeSeries(ctx, shortCode, query)
+	if err != nil {
+		return nil, domain.Internal(fmt.Errorf("failed to get click time series: %w", err))
+	}
+
+	analytics.Interval = query.Interval
+	analytics.From = &query.From
+	analytics.To = &query.To
+	analytics.TimeSeries = fillTimeSeries(points, query)
+
+	if len(urlEntity.Variants) > 0 {
+		counts, err := s.store.CountClicksByVariant(ctx, shortCode, query)
+		if err != nil {
+			return nil, domain.Internal(fmt.Errorf("failed to count clicks by variant: %w", err))
+		}
+		analytics.Variants = variantClicks(urlEntity.Variants, counts)
+	}
+
 	return analytics, nil
 }
 
-// incrementClickCountAsync increments click count asynchronously
-func (s *URLService) incrementClickCountAsync(shortCode string) {
-	ctx := context.Background()
-	err := s.pgRepo.IncrementClickCount(ctx, shortCode)
+// getOwnedURL retrieves a URL, expired or not, and checks that it belongs to
+// ownerID. Links owned by someone else are reported as domain.ErrNotFound so
+// their existence is not revealed.
+func (s *URLService) getOwnedURL(ctx context.Context, shortCode, ownerID string) (*domain.URL, error) {
+	urlEntity, err := s.store.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
-		log.Printf("Failed to increment click count for %s: %v", shortCode, err)
+		return nil, lookupError(err)
+	}
+	if ownerID == "" || urlEntity.UserID == nil || *urlEntity.UserID != ownerID {
+		return nil, domain.ErrNotFound
+	}
+	return urlEntity, nil
+}
+
+// lookupError passes domain.ErrNotFound through and wraps anything else as an internal error
+func lookupError(err error) error {
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.ErrNotFound
+	}
+	return domain.Internal(err)
+}
+
+// startSpan starts the span of the URLService method named method
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "URLService."+method, trace.WithAttributes(attrs...))
+}
+
+// shortCodeAttr is the span attribute naming the short code a method acts on
+func shortCodeAttr(shortCode string) attribute.KeyValue {
+	return attribute.String(logging.ShortCodeKey, shortCode)
+}
+
+// invalidateCache evicts a short code from the cache so redirects never serve a stale target
+func (s *URLService) invalidateCache(ctx context.Context, shortCode string) {
+	if err := s.cache.Delete(ctx, shortCode); err != nil {
+		slog.ErrorContext(logging.WithShortCode(ctx, shortCode), "Failed to invalidate cache", "error", err)
 	}
 }
 
-// isValidURL checks if a string is a valid URL
-func isValidURL(str string) bool {
-	u, err := url.Parse(str)
+// newClickEvent builds the click event recorded for a visit sent to dest
+func (s *URLService) newClickEvent(shortCode string, visit *domain.Visit, dest *domain.Destination) *domain.ClickEvent {
+	event := &domain.ClickEvent{
+		ShortCode:  shortCode,
+		OccurredAt: time.Now().UTC(),
+		Variant:    dest.Variant,
+	}
+	if visit != nil {
+		event.Referrer = visit.Referrer
+		event.UserAgent = visit.UserAgent
+		event.IPHash = s.hashIP(visit.ClientIP)
+	}
+	return event
+}
+
+// recordClick hands the click to the aggregator, or writes it directly when
+// no aggregator is configured
+func (s *URLService) recordClick(ctx context.Context, event *domain.ClickEvent) {
+	if s.clicks != nil {
+		s.clicks.Add(event)
+		return
+	}
+
+	delta := domain.ClickDelta{ShortCode: event.ShortCode, Clicks: 1, LastAccessed: event.OccurredAt}
+	if err := s.store.IncrementClickCounts(ctx, []domain.ClickDelta{delta}); err != nil {
+		slog.ErrorContext(ctx, "Failed to increment click count", "error", err)
+	}
+	if err := s.store.RecordClickEvents(ctx, []*domain.ClickEvent{event}); err != nil {
+		slog.ErrorContext(ctx, "Failed to record click event", "error", err)
+	}
+}
+
+// hashIP returns a salted SHA-256 hash of a client IP so raw addresses are never stored
+func (s *URLService) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s.ipHashSalt + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// fillTimeSeries expands sparse bucket counts into a contiguous series covering the query range
+func fillTimeSeries(points []domain.TimeSeriesPoint, query domain.AnalyticsQuery) []domain.TimeSeriesPoint {
+	counts := make(map[time.Time]int64, len(points))
+	for _, p := range points {
+		counts[p.Timestamp.UTC()] += p.Clicks
+	}
+
+	series := []domain.TimeSeriesPoint{}
+	for t := query.Interval.Truncate(query.From); t.Before(query.To); t = query.Interval.Next(t) {
+		series = append(series, domain.TimeSeriesPoint{Timestamp: t, Clicks: counts[t]})
+	}
+	return series
+}
+
+// encodeCursor turns the last ID of a page into an opaque pagination cursor
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return false
+		return 0, domain.Invalid("invalid cursor")
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, domain.Invalid("invalid cursor")
 	}
-	return u.Scheme != "" && u.Host != ""
+	return id, nil
+}
+
+// reservedAliases are custom aliases that would shadow API routes
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"batch":   true,
+	"health":  true,
+	"livez":   true,
+	"readyz":  true,
+	"metrics": true,
 }
 
 // isValidCustomAlias checks if a custom alias is valid
 func isValidCustomAlias(alias string) bool {
-	if len(alias) < 3 || len(alias) > 20 {
+	if len(alias) < 3 || len(alias) > 20 || reservedAliases[strings.ToLower(alias)] {
 		return false
 	}
 	for _, c := range alias {
@@ -0,0 +1,801 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+)
+
+const (
+	testBaseURL = "http://sho.rt"
+	testOwner   = "7f8e5a9c-2b1d-4c3e-9f0a-1b2c3d4e5f60"
+)
+
+func newTestService() (*URLService, *repository.MemoryRepository, *repository.MemoryCache) {
+	store := repository.NewMemoryRepository()
+	cache := repository.NewMemoryCache()
+	return NewURLService(store, cache, testBaseURL), store, cache
+}
+
+func TestShortenURL(t *testing.T) {
+	svc, store, cache := newTestService()
+	ctx := context.Background()
+
+	resp, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com"}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	shortCode := strings.TrimPrefix(resp.ShortURL, testBaseURL+"/")
+	if shortCode == "" || shortCode == resp.ShortURL {
+		t.Fatalf("Unexpected short URL %q", resp.ShortURL)
+	}
+
+	if _, err := store.GetURLByShortCode(ctx, shortCode); err != nil {
+		t.Errorf("Expected URL to be stored, got error: %v", err)
+	}
+
+	cached, err := cache.Get(ctx, shortCode)
+	if err != nil || cached.URL != "https://example.com" {
+		t.Errorf("Expected URL to be cached, got %+v (err: %v)", cached, err)
+	}
+}
+
+func TestShortenURL_InvalidURL(t *testing.T) {
+	svc, _, _ := newTestService()
+
+	_, err := svc.ShortenURL(context.Background(), &domain.CreateURLRequest{LongURL: "not-a-url"}, testOwner)
+	var appErr *domain.Error
+	if !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest {
+		t.Errorf("Expected 400 domain error for invalid URL, got %v", err)
+	}
+}
+
+func TestShortenURL_CustomAlias(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+	alias := "my-link"
+
+	resp, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if resp.ShortURL != testBaseURL+"/my-link" {
+		t.Errorf("Expected short URL %q, got %q", testBaseURL+"/my-link", resp.ShortURL)
+	}
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.org", CustomAlias: &alias}, testOwner); !errors.Is(err, domain.ErrAliasTaken) {
+		t.Errorf("Expected ErrAliasTaken for duplicate alias, got %v", err)
+	}
+}
+
+func TestShortenURL_ReservedAlias(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	for _, alias := range []string{"api", "health", "livez", "ReadyZ", "metrics"} {
+		alias := alias
+		_, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner)
+		var appErr *domain.Error
+		if !errors.As(err, &appErr) || appErr.Status != 400 {
+			t.Errorf("Expected the alias %q to be rejected, got %v", alias, err)
+		}
+	}
+}
+
+func TestGetOriginalURL_CacheMissFallsBackToStore(t *testing.T) {
+	svc, _, cache := newTestService()
+	ctx := context.Background()
+	alias := "fallback"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/a", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	_ = cache.Delete(ctx, alias)
+
+	dest, err := svc.GetOriginalURL(ctx, alias, nil)
+	if err != nil {
+		t.Fatalf("GetOriginalURL returned error: %v", err)
+	}
+	if dest.URL != "https://example.com/a" {
+		t.Errorf("Expected original URL %q, got %q", "https://example.com/a", dest.URL)
+	}
+
+	if exists, _ := cache.Exists(ctx, alias); !exists {
+		t.Error("Expected cache to be repopulated after miss")
+	}
+}
+
+func TestGetOriginalURL_NotFound(t *testing.T) {
+	svc, _, _ := newTestService()
+
+	if _, err := svc.GetOriginalURL(context.Background(), "missing", nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetOriginalURL_ExpiredAndDisabled(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	if err := store.CreateURL(ctx, &domain.URL{ShortCode: "old", OriginalURL: "https://example.com", ExpiresAt: &past, UserID: strPtr(testOwner)}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+	if err := store.CreateURL(ctx, &domain.URL{ShortCode: "off", OriginalURL: "https://example.com", Disabled: true}); err != nil {
+		t.Fatalf("CreateURL returned error: %v", err)
+	}
+
+	if _, err := svc.GetOriginalURL(ctx, "old", nil); !errors.Is(err, domain.ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if _, err := svc.GetOriginalURL(ctx, "off", nil); !errors.Is(err, domain.ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+
+	// Owners can still read analytics of expired links
+	if _, err := svc.GetAnalytics(ctx, "old", testOwner, domain.AnalyticsQuery{}); err != nil {
+		t.Errorf("Expected analytics for expired link, got error: %v", err)
+	}
+}
+
+func TestUpdateURL_Disable(t *testing.T) {
+	svc, _, cache := newTestService()
+	ctx := context.Background()
+	alias := "switch"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	disabled := true
+	if _, err := svc.UpdateURL(ctx, alias, testOwner, &domain.UpdateURLRequest{Disabled: &disabled}); err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if exists, _ := cache.Exists(ctx, alias); exists {
+		t.Error("Expected cache entry to be invalidated after disabling")
+	}
+	if _, err := svc.GetOriginalURL(ctx, alias, nil); !errors.Is(err, domain.ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestGetAnalytics_TimeSeries(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+	alias := "series"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{day.Add(time.Hour), day.Add(2 * time.Hour), day.AddDate(0, 0, 2)} {
+		if err := store.RecordClickEvents(ctx, []*domain.ClickEvent{{ShortCode: alias, OccurredAt: at}}); err != nil {
+			t.Fatalf("RecordClickEvents returned error: %v", err)
+		}
+	}
+
+	analytics, err := svc.GetAnalytics(ctx, alias, testOwner, domain.AnalyticsQuery{
+		From:     day,
+		To:       day.AddDate(0, 0, 3),
+		Interval: domain.IntervalDay,
+	})
+	if err != nil {
+		t.Fatalf("GetAnalytics returned error: %v", err)
+	}
+
+	want := []int64{2, 0, 1}
+	if len(analytics.TimeSeries) != len(want) {
+		t.Fatalf("Expected %d buckets, got %d", len(want), len(analytics.TimeSeries))
+	}
+	for i, clicks := range want {
+		if analytics.TimeSeries[i].Clicks != clicks {
+			t.Errorf("Bucket %d: expected %d clicks, got %d", i, clicks, analytics.TimeSeries[i].Clicks)
+		}
+	}
+}
+
+func TestGetAnalytics_InvalidInterval(t *testing.T) {
+	svc, _, _ := newTestService()
+
+	if _, err := svc.GetAnalytics(context.Background(), "any", testOwner, domain.AnalyticsQuery{Interval: "month"}); err == nil {
+		t.Error("Expected error for unsupported interval, got none")
+	}
+}
+
+func TestHashIP(t *testing.T) {
+	svc := NewURLService(nil, nil, testBaseURL, WithIPHashSalt("pepper"))
+
+	hashed := svc.hashIP("203.0.113.7")
+	if hashed == "" || strings.Contains(hashed, "203.0.113.7") {
+		t.Errorf("Expected opaque hash, got %q", hashed)
+	}
+	if hashed != svc.hashIP("203.0.113.7") {
+		t.Error("Expected hashing to be deterministic")
+	}
+	if svc.hashIP("") != "" {
+		t.Error("Expected empty IP to hash to empty string")
+	}
+}
+
+func TestUpdateURL_InvalidatesCache(t *testing.T) {
+	svc, _, cache := newTestService()
+	ctx := context.Background()
+	alias := "moving"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/old", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	newURL := "https://example.com/new"
+	ttl := 3
+	updated, err := svc.UpdateURL(ctx, alias, testOwner, &domain.UpdateURLRequest{LongURL: &newURL, TTLDays: &ttl})
+	if err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if updated.OriginalURL != newURL || updated.ExpiresAt == nil {
+		t.Errorf("Unexpected updated URL: %+v", updated)
+	}
+
+	if exists, _ := cache.Exists(ctx, alias); exists {
+		t.Error("Expected cache entry to be invalidated after update")
+	}
+
+	dest, err := svc.GetOriginalURL(ctx, alias, nil)
+	if err != nil {
+		t.Fatalf("GetOriginalURL returned error: %v", err)
+	}
+	if dest.URL != newURL {
+		t.Errorf("Expected redirect to %q, got %q", newURL, dest.URL)
+	}
+}
+
+func TestUpdateURL_Validation(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+	alias := "strict"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	invalid := "not-a-url"
+	past := time.Now().Add(-time.Hour)
+	zero := 0
+	for name, req := range map[string]*domain.UpdateURLRequest{
+		"invalid URL":  {LongURL: &invalid},
+		"past expiry":  {ExpiresAt: &past},
+		"zero TTL":     {TTLDays: &zero},
+		"both expires": {ExpiresAt: &past, TTLDays: &zero},
+	} {
+		if _, err := svc.UpdateURL(ctx, alias, testOwner, req); err == nil {
+			t.Errorf("%s: expected error, got none", name)
+		}
+	}
+
+	if _, err := svc.UpdateURL(ctx, "missing", testOwner, &domain.UpdateURLRequest{}); err == nil {
+		t.Error("Expected error for unknown short code, got none")
+	}
+}
+
+func TestDeleteURL(t *testing.T) {
+	svc, _, cache := newTestService()
+	ctx := context.Background()
+	alias := "doomed"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	if err := svc.DeleteURL(ctx, alias, testOwner); err != nil {
+		t.Fatalf("DeleteURL returned error: %v", err)
+	}
+	if exists, _ := cache.Exists(ctx, alias); exists {
+		t.Error("Expected cache entry to be invalidated after delete")
+	}
+	if _, err := svc.GetOriginalURL(ctx, alias, nil); err == nil {
+		t.Error("Expected deleted URL to be unresolvable")
+	}
+	if err := svc.DeleteURL(ctx, alias, testOwner); err == nil {
+		t.Error("Expected error deleting an already deleted URL")
+	}
+}
+
+func TestDeleteURL_ReusedCodeStartsWithoutClicks(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+	alias := "recycled"
+	create := func() {
+		if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+			t.Fatalf("ShortenURL returned error: %v", err)
+		}
+	}
+
+	create()
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	if err := store.RecordClickEvents(ctx, []*domain.ClickEvent{{ShortCode: alias, OccurredAt: day}}); err != nil {
+		t.Fatalf("RecordClickEvents returned error: %v", err)
+	}
+	if err := svc.DeleteURL(ctx, alias, testOwner); err != nil {
+		t.Fatalf("DeleteURL returned error: %v", err)
+	}
+
+	create()
+	analytics, err := svc.GetAnalytics(ctx, alias, testOwner, domain.AnalyticsQuery{
+		From:     day,
+		To:       day.AddDate(0, 0, 1),
+		Interval: domain.IntervalDay,
+	})
+	if err != nil {
+		t.Fatalf("GetAnalytics returned error: %v", err)
+	}
+	for _, point := range analytics.TimeSeries {
+		if point.Clicks != 0 {
+			t.Errorf("Expected the new link not to inherit the deleted link's clicks, got %+v", analytics.TimeSeries)
+		}
+	}
+}
+
+func TestListURLs_CursorPagination(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com"}, testOwner); err != nil {
+			t.Fatalf("ShortenURL returned error: %v", err)
+		}
+	}
+
+	seen := make(map[int64]bool)
+	cursor := ""
+	pages := 0
+	for {
+		page, err := svc.ListURLs(ctx, testOwner, domain.URLFilter{Limit: 2}, cursor)
+		if err != nil {
+			t.Fatalf("ListURLs returned error: %v", err)
+		}
+		pages++
+		for _, u := range page.URLs {
+			if seen[u.ID] {
+				t.Fatalf("URL %d returned twice", u.ID)
+			}
+			seen[u.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if len(seen) != 5 || pages != 3 {
+		t.Errorf("Expected 5 URLs over 3 pages, got %d over %d", len(seen), pages)
+	}
+
+	if _, err := svc.ListURLs(ctx, testOwner, domain.URLFilter{}, "!!"); err == nil {
+		t.Error("Expected error for malformed cursor, got none")
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+	alias := "mine"
+	anonymous := "theirs"
+	intruder := "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &anonymous}, ""); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	owned, err := svc.GetURL(ctx, alias, testOwner)
+	if err != nil {
+		t.Fatalf("GetURL returned error for owner: %v", err)
+	}
+	if owned.UserID == nil || *owned.UserID != testOwner {
+		t.Errorf("Expected link to be stamped with owner, got %v", owned.UserID)
+	}
+
+	if _, err := svc.GetURL(ctx, alias, intruder); err == nil {
+		t.Error("Expected non-owner to be denied")
+	}
+	if err := svc.DeleteURL(ctx, alias, intruder); err == nil {
+		t.Error("Expected non-owner delete to be denied")
+	}
+	if _, err := svc.GetAnalytics(ctx, alias, intruder, domain.AnalyticsQuery{}); err == nil {
+		t.Error("Expected non-owner analytics to be denied")
+	}
+	if _, err := svc.GetURL(ctx, anonymous, testOwner); err == nil {
+		t.Error("Expected anonymous links to be unmanageable")
+	}
+
+	page, err := svc.ListURLs(ctx, intruder, domain.URLFilter{}, "")
+	if err != nil {
+		t.Fatalf("ListURLs returned error: %v", err)
+	}
+	if len(page.URLs) != 0 {
+		t.Errorf("Expected listing to be scoped to the caller, got %d URLs", len(page.URLs))
+	}
+}
+
+func TestShortenURLs(t *testing.T) {
+	svc, store, cache := newTestService()
+	ctx := context.Background()
+
+	taken := "taken"
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &taken}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	fresh := "fresh"
+	ttl := 7
+	results, err := svc.ShortenURLs(ctx, []*domain.CreateURLRequest{
+		{LongURL: "https://example.com/a"},
+		{LongURL: "not-a-url"},
+		{LongURL: "https://example.com/b", CustomAlias: &fresh, TTLDays: &ttl},
+		{LongURL: "https://example.com/c", CustomAlias: &fresh},
+		{LongURL: "https://example.com/d", CustomAlias: &taken},
+	}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURLs returned error: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(results))
+	}
+
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil || results[i].Response == nil {
+			t.Errorf("Expected item %d to be created, got error %v", i, results[i].Err)
+		}
+	}
+	if results[2].Response.ShortURL != testBaseURL+"/fresh" || results[2].Response.ExpiresAt == nil {
+		t.Errorf("Expected item 2 to use its alias and TTL, got %+v", results[2].Response)
+	}
+
+	var appErr *domain.Error
+	if !errors.As(results[1].Err, &appErr) || appErr.Status != http.StatusBadRequest {
+		t.Errorf("Expected item 1 to fail validation, got %v", results[1].Err)
+	}
+	for _, i := range []int{3, 4} {
+		if !errors.Is(results[i].Err, domain.ErrAliasTaken) {
+			t.Errorf("Expected item %d to fail with ErrAliasTaken, got %v", i, results[i].Err)
+		}
+	}
+
+	for _, code := range []string{"fresh", strings.TrimPrefix(results[0].Response.ShortURL, testBaseURL+"/")} {
+		u, err := store.GetURLByShortCode(ctx, code)
+		if err != nil {
+			t.Fatalf("Expected %q to be stored: %v", code, err)
+		}
+		if u.UserID == nil || *u.UserID != testOwner {
+			t.Errorf("Expected %q to be owned by the caller", code)
+		}
+		if cached, err := cache.Get(ctx, code); err != nil || cached.URL != u.OriginalURL {
+			t.Errorf("Expected %q to be pre-warmed in the cache, got %+v (err: %v)", code, cached, err)
+		}
+	}
+}
+
+func TestShortenURLs_Limit(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	svc := NewURLService(store, repository.NewMemoryCache(), testBaseURL, WithMaxBatchSize(2))
+
+	reqs := []*domain.CreateURLRequest{
+		{LongURL: "https://example.com/a"},
+		{LongURL: "https://example.com/b"},
+		{LongURL: "https://example.com/c"},
+	}
+	var appErr *domain.Error
+	if _, err := svc.ShortenURLs(context.Background(), reqs, testOwner); !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest {
+		t.Errorf("Expected 400 domain error above the batch limit, got %v", err)
+	}
+	if _, err := svc.ShortenURLs(context.Background(), nil, testOwner); err == nil {
+		t.Error("Expected error for an empty batch, got none")
+	}
+}
+
+func TestShortenURL_ReuseExisting(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	first, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://Example.com/page"}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	reused, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "HTTPS://example.COM/page", ReuseExisting: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if !reused.Reused || reused.ShortURL != first.ShortURL {
+		t.Errorf("Expected existing link %q to be reused, got %+v", first.ShortURL, reused)
+	}
+
+	fresh, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/page"}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if fresh.Reused || fresh.ShortURL == first.ShortURL {
+		t.Error("Expected a new link without reuse_existing")
+	}
+
+	other, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/page", ReuseExisting: true}, "someone-else")
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if other.Reused {
+		t.Error("Expected links of other owners not to be reused")
+	}
+
+	results, err := svc.ShortenURLs(ctx, []*domain.CreateURLRequest{
+		{LongURL: "https://example.com/page", ReuseExisting: true},
+		{LongURL: "https://example.com/new", ReuseExisting: true},
+	}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURLs returned error: %v", err)
+	}
+	if !results[0].Response.Reused || results[0].Response.ShortURL != fresh.ShortURL {
+		t.Errorf("Expected newest link %q to be reused in bulk, got %+v", fresh.ShortURL, results[0].Response)
+	}
+	if results[1].Response.Reused {
+		t.Error("Expected a link for an unseen URL to be created")
+	}
+}
+
+func TestShortenURL_ReuseExistingWithExpiry(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	permanent, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/sale"}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	oneDay := 1
+	expiring, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/sale", TTLDays: &oneDay, ReuseExisting: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if expiring.Reused || expiring.ShortURL == permanent.ShortURL || expiring.ExpiresAt == nil {
+		t.Errorf("Expected a new expiring link instead of the permanent one, got %+v", expiring)
+	}
+
+	expiresAt := time.Now().Add(48 * time.Hour)
+	other, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/sale", ExpiresAt: &expiresAt, ReuseExisting: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if other.Reused {
+		t.Errorf("Expected requests with expires_at not to be reused, got %+v", other)
+	}
+
+	// A request without expiry must not get back an expiring link
+	_, err = svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/flash", TTLDays: &oneDay}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	reused, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com/flash", ReuseExisting: true}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if reused.Reused || reused.ExpiresAt != nil {
+		t.Errorf("Expected a new permanent link instead of the expiring one, got %+v", reused)
+	}
+}
+
+func TestGetOriginalURL_ActivationWindow(t *testing.T) {
+	svc, store, cache := newTestService()
+	ctx := context.Background()
+
+	alias := "launch"
+	activatesAt := time.Now().Add(time.Hour)
+	expiresAt := activatesAt.Add(48 * time.Hour)
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/launch",
+		CustomAlias: &alias,
+		ActivatesAt: &activatesAt,
+		ExpiresAt:   &expiresAt,
+	}, ""); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	_, err := svc.GetOriginalURL(ctx, alias, nil)
+	var appErr *domain.Error
+	if !errors.As(err, &appErr) || appErr.Code != domain.CodeNotYetActive {
+		t.Fatalf("Expected not_yet_active, got %v", err)
+	}
+	if appErr.RetryAfter <= 59*time.Minute || appErr.RetryAfter > time.Hour {
+		t.Errorf("Expected to retry in about an hour, got %s", appErr.RetryAfter)
+	}
+	if _, err := cache.Get(ctx, alias); err == nil {
+		t.Error("Expected links that are not active yet not to be cached")
+	}
+
+	urlEntity, _ := store.GetURLByShortCode(ctx, alias)
+	past := time.Now().Add(-time.Minute)
+	urlEntity.ActivatesAt = &past
+	if err := store.UpdateURL(ctx, urlEntity); err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+
+	if dest, err := svc.GetOriginalURL(ctx, alias, nil); err != nil || dest.URL != "https://example.com/launch" {
+		t.Fatalf("Expected the active link to resolve, got %+v, %v", dest, err)
+	}
+	if _, err := cache.Get(ctx, alias); err != nil {
+		t.Error("Expected the active link to be cached")
+	}
+}
+
+func TestShortenURL_StoresScheduleInUTC(t *testing.T) {
+	svc, store, _ := newTestService()
+	ctx := context.Background()
+
+	zone := time.FixedZone("UTC+7", 7*60*60)
+	activatesAt := time.Now().Add(time.Hour).In(zone)
+	expiresAt := activatesAt.Add(24 * time.Hour)
+	alias := "jakarta"
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		LongURL:     "https://example.com/sale",
+		CustomAlias: &alias,
+		ActivatesAt: &activatesAt,
+		ExpiresAt:   &expiresAt,
+	}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	urlEntity, _ := store.GetURLByShortCode(ctx, alias)
+	if urlEntity.ActivatesAt.Location() != time.UTC || !urlEntity.ActivatesAt.Equal(activatesAt) {
+		t.Errorf("Expected activates_at %s in UTC, got %s", activatesAt.UTC(), urlEntity.ActivatesAt)
+	}
+	if urlEntity.ExpiresAt.Location() != time.UTC || !urlEntity.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected expires_at %s in UTC, got %s", expiresAt.UTC(), urlEntity.ExpiresAt)
+	}
+
+	expiresAt = expiresAt.Add(time.Hour)
+	updated, err := svc.UpdateURL(ctx, alias, testOwner, &domain.UpdateURLRequest{ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if updated.ExpiresAt.Location() != time.UTC || !updated.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected updated expires_at %s in UTC, got %s", expiresAt.UTC(), updated.ExpiresAt)
+	}
+}
+
+func TestShortenURL_ScheduleValidation(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	now := time.Now()
+	past, soon, later := now.Add(-time.Hour), now.Add(time.Hour), now.Add(2*time.Hour)
+	ttl := 7
+
+	tests := []struct {
+		name string
+		req  *domain.CreateURLRequest
+	}{
+		{"past expiry", &domain.CreateURLRequest{ExpiresAt: &past}},
+		{"expiry and ttl", &domain.CreateURLRequest{ExpiresAt: &later, TTLDays: &ttl}},
+		{"expiry before activation", &domain.CreateURLRequest{ActivatesAt: &later, ExpiresAt: &soon}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.LongURL = "https://example.com"
+			_, err := svc.ShortenURL(ctx, tt.req, "")
+
+			var appErr *domain.Error
+			if !errors.As(err, &appErr) || appErr.Code != "invalid_request" {
+				t.Errorf("Expected invalid_request, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	past, soon := now.Add(-time.Minute), now.Add(90*time.Minute)
+	limit := int64(1)
+
+	tests := []struct {
+		name    string
+		url     *domain.URL
+		wantTTL time.Duration
+		wantOK  bool
+	}{
+		{"no expiry", &domain.URL{}, 24 * time.Hour, true},
+		{"expiring", &domain.URL{ExpiresAt: &soon}, 90 * time.Minute, true},
+		{"expired", &domain.URL{ExpiresAt: &past}, 0, false},
+		{"pending", &domain.URL{ActivatesAt: &soon}, 0, false},
+		{"activated", &domain.URL{ActivatesAt: &past, ExpiresAt: &soon}, 90 * time.Minute, true},
+		{"click-limited", &domain.URL{MaxClicks: &limit}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, ok := cacheTTL(tt.url, now)
+			if ok != tt.wantOK || (ok && ttl != tt.wantTTL) {
+				t.Errorf("cacheTTL = %s, %v; want %s, %v", ttl, ok, tt.wantTTL, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestShortenURL_RedirectType(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	alias := "typed"
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, testOwner); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	urlEntity, err := svc.GetURL(ctx, alias, testOwner)
+	if err != nil || urlEntity.RedirectType != domain.RedirectFound {
+		t.Fatalf("Expected links to default to 302, got %+v, %v", urlEntity, err)
+	}
+
+	for _, req := range []*domain.CreateURLRequest{
+		{LongURL: "https://example.com", RedirectType: "303"},
+		{LongURL: "https://example.com", Title: strings.Repeat("x", maxTitleLength+1)},
+	} {
+		if _, err := svc.ShortenURL(ctx, req, testOwner); err == nil {
+			t.Errorf("Expected %+v to be rejected", req)
+		}
+	}
+
+	interstitial, title := domain.RedirectInterstitial, "  Docs  "
+	updated, err := svc.UpdateURL(ctx, alias, testOwner, &domain.UpdateURLRequest{RedirectType: &interstitial, Title: &title})
+	if err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if updated.RedirectType != domain.RedirectInterstitial || updated.Title != "Docs" {
+		t.Errorf("Expected an interstitial titled %q, got %q titled %q", "Docs", updated.RedirectType, updated.Title)
+	}
+	dest, err := svc.GetOriginalURL(ctx, alias, nil)
+	if err != nil || dest.Type != domain.RedirectInterstitial || dest.Title != "Docs" {
+		t.Errorf("Expected the destination to carry the redirect type and title, got %+v, %v", dest, err)
+	}
+}
+
+func TestURLService_Metrics(t *testing.T) {
+	m := metrics.New()
+	svc := NewURLService(repository.NewMemoryRepository(), repository.NewMemoryCache(), testBaseURL, WithMetrics(m))
+	ctx := context.Background()
+
+	alias := "counted"
+	if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{LongURL: "https://example.com", CustomAlias: &alias}, ""); err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+	if _, err := svc.GetOriginalURL(ctx, alias, nil); err != nil {
+		t.Fatalf("GetOriginalURL returned error: %v", err)
+	}
+	if _, err := svc.GetOriginalURL(ctx, "missing", nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`shortener_cache_lookups_total{result="hit"} 1`,
+		`shortener_cache_lookups_total{result="miss"} 1`,
+		`shortener_links_created_total 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected the metrics to contain %q", want)
+		}
+	}
+}
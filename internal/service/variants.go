@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"url-shortener/internal/domain"
+)
+
+// Bounds of the A/B variants of one link and of their weights
+const (
+	minVariants      = 2
+	maxVariants      = 10
+	maxVariantWeight = 1000
+)
+
+// variantName matches the names of A/B variants
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+
+// compileVariants validates A/B variants, checking their targets against the
+// URL policy (and normalizing them if normalize is set). Variants without a
+// name are named A, B, C... by position.
+func (s *URLService) compileVariants(variants []domain.Variant, normalize bool) ([]domain.Variant, error) {
+	if len(variants) < minVariants || len(variants) > maxVariants {
+		return nil, domain.Invalid(fmt.Sprintf("an A/B split needs %d to %d variants", minVariants, maxVariants))
+	}
+
+	compiled := make([]domain.Variant, 0, len(variants))
+	names := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		if variant.Name == "" {
+			variant.Name = string(rune('A' + i))
+		}
+		if !variantName.MatchString(variant.Name) {
+			return nil, domain.Invalid(fmt.Sprintf("variant %d: name must be 1-20 letters, digits, - or _", i+1))
+		}
+		if names[variant.Name] {
+			return nil, domain.Invalid(fmt.Sprintf("variant %d: duplicate name %q", i+1, variant.Name))
+		}
+		names[variant.Name] = true
+
+		if variant.Weight <= 0 || variant.Weight > maxVariantWeight {
+			return nil, domain.Invalid(fmt.Sprintf("variant %d: weight must be between 1 and %d", i+1, maxVariantWeight))
+		}
+
+		targetURL, _, err := s.destination(variant.TargetURL, normalize)
+		if err != nil {
+			var appErr *domain.Error
+			if errors.As(err, &appErr) && appErr.Reason != "" {
+				return nil, domain.URLRejected(appErr.Reason, fmt.Sprintf("variant %d: %s", i+1, appErr.Message))
+			}
+			return nil, err
+		}
+		variant.TargetURL = targetURL
+
+		compiled = append(compiled, variant)
+	}
+	return compiled, nil
+}
+
+// assignVariant picks the A/B variant for a visit. A visitor who was assigned
+// a variant before (and presents it again) keeps it; anyone else is placed
+// deterministically by a hash of the short code and their hashed IP, so
+// repeated visits land on the same variant with the configured weights.
+func (s *URLService) assignVariant(shortCode string, variants []domain.Variant, visit *domain.Visit) domain.Variant {
+	var clientIP string
+	if visit != nil {
+		for _, variant := range variants {
+			if variant.Name == visit.Variant {
+				return variant
+			}
+		}
+		clientIP = visit.ClientIP
+	}
+
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+
+	sum := sha256.Sum256([]byte(shortCode + "\n" + s.hashIP(clientIP)))
+	point := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, variant := range variants {
+		if point < variant.Weight {
+			return variant
+		}
+		point -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// variantClicks lists the clicks per variant of a link, in variant order
+func variantClicks(variants []domain.Variant, counts map[string]int64) []domain.VariantClicks {
+	if len(variants) == 0 {
+		return nil
+	}
+	clicks := make([]domain.VariantClicks, len(variants))
+	for i, variant := range variants {
+		clicks[i] = domain.VariantClicks{Variant: variant, Clicks: counts[variant.Name]}
+	}
+	return clicks
+}
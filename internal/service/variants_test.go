@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"url-shortener/internal/domain"
+)
+
+func TestGetOriginalURL_Variants(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	alias := "split"
+	_, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{
+		CustomAlias: &alias,
+		Variants: []domain.Variant{
+			{TargetURL: "https://example.com/a", Weight: 70},
+			{TargetURL: "https://example.com/b", Weight: 30},
+		},
+	}, testOwner)
+	if err != nil {
+		t.Fatalf("ShortenURL returned error: %v", err)
+	}
+
+	urlEntity, err := svc.GetURL(ctx, alias, testOwner)
+	if err != nil {
+		t.Fatalf("GetURL returned error: %v", err)
+	}
+	if urlEntity.OriginalURL != "https://example.com/a" || urlEntity.Variants[0].Name != "A" || urlEntity.Variants[1].Name != "B" {
+		t.Fatalf("Expected the first variant as long URL and default names, got %+v", urlEntity)
+	}
+
+	counts := map[string]int{}
+	clicks := map[string]int64{}
+	for i := 0; i < 1000; i++ {
+		visit := &domain.Visit{ClientIP: fmt.Sprintf("198.51.%d.%d", i/256, i%256)}
+		dest, err := svc.GetOriginalURL(ctx, alias, visit)
+		if err != nil {
+			t.Fatalf("GetOriginalURL returned error: %v", err)
+		}
+		counts[dest.Variant]++
+		clicks[dest.Variant]++
+
+		// The same visitor lands on the same variant again
+		again, _ := svc.GetOriginalURL(ctx, alias, visit)
+		if again.Variant != dest.Variant || again.URL != dest.URL {
+			t.Fatalf("Expected sticky assignment for %s, got %q then %q", visit.ClientIP, dest.Variant, again.Variant)
+		}
+		clicks[again.Variant]++
+	}
+	if counts["A"] < 630 || counts["A"] > 770 {
+		t.Errorf("Expected about 70%% of visitors on A, got %v", counts)
+	}
+
+	// A remembered variant wins over the hash
+	dest, _ := svc.GetOriginalURL(ctx, alias, &domain.Visit{ClientIP: "198.51.0.1", Variant: "B"})
+	if dest.Variant != "B" || dest.URL != "https://example.com/b" {
+		t.Errorf("Expected the remembered variant B, got %+v", dest)
+	}
+	clicks["B"]++
+
+	analytics, err := svc.GetAnalytics(ctx, alias, testOwner, domain.AnalyticsQuery{})
+	if err != nil {
+		t.Fatalf("GetAnalytics returned error: %v", err)
+	}
+	if len(analytics.Variants) != 2 {
+		t.Fatalf("Expected clicks for 2 variants, got %+v", analytics.Variants)
+	}
+	for _, v := range analytics.Variants {
+		if v.Clicks != clicks[v.Name] {
+			t.Errorf("Variant %s: expected %d clicks, got %d", v.Name, clicks[v.Name], v.Clicks)
+		}
+	}
+}
+
+func TestShortenURL_InvalidVariants(t *testing.T) {
+	svc, _, _ := newTestService()
+	ctx := context.Background()
+
+	a := domain.Variant{TargetURL: "https://example.com/a", Weight: 1}
+	b := domain.Variant{TargetURL: "https://example.com/b", Weight: 1}
+	tests := map[string][]domain.Variant{
+		"single variant":  {a},
+		"zero weight":     {a, {TargetURL: "https://example.com/b"}},
+		"duplicate names": {{Name: "x", TargetURL: a.TargetURL, Weight: 1}, {Name: "x", TargetURL: b.TargetURL, Weight: 1}},
+		"invalid name":    {{Name: "no spaces", TargetURL: a.TargetURL, Weight: 1}, b},
+		"rejected target": {a, {TargetURL: "javascript:alert(1)", Weight: 1}},
+	}
+	for name, variants := range tests {
+		if _, err := svc.ShortenURL(ctx, &domain.CreateURLRequest{Variants: variants}, testOwner); err == nil {
+			t.Errorf("%s: expected the variants to be rejected", name)
+		}
+	}
+}
@@ -6,6 +6,12 @@
 set -e
 
 BASE_URL="${BASE_URL:-http://localhost:8080}"
+# API key for owner-only endpoints (create one with: go run ./cmd/server apikey create)
+API_KEY="${API_KEY:-}"
+AUTH_HEADER=()
+if [ -n "$API_KEY" ]; then
+    AUTH_HEADER=(-H "Authorization: Bearer $API_KEY")
+fi
 FAILED=0
 PASSED=0
 
@@ -48,6 +54,7 @@ echo ""
 # Test 2: Create Short URL
 echo "Test 2: Create Short URL"
 RESPONSE=$(curl -s -w "\n%{http_code}" -X POST "$BASE_URL/api/v1/urls" \
+    "${AUTH_HEADER[@]}" \
     -H "Content-Type: application/json" \
     -d '{"long_url":"https://www.google.com"}')
 HTTP_CODE=$(echo "$RESPONSE" | tail -n1)
@@ -76,14 +83,20 @@ if [ -n "$SHORT_CODE" ]; then
     echo ""
 fi
 
-# Test 4: Analytics
+# Test 4: Analytics (owner only)
 if [ -n "$SHORT_CODE" ]; then
     echo "Test 4: Get Analytics"
-    RESPONSE=$(curl -s -w "\n%{http_code}" "$BASE_URL/api/v1/analytics/$SHORT_CODE")
+    RESPONSE=$(curl -s -w "\n%{http_code}" "${AUTH_HEADER[@]}" "$BASE_URL/api/v1/analytics/$SHORT_CODE")
     HTTP_CODE=$(echo "$RESPONSE" | tail -n1)
     BODY=$(echo "$RESPONSE" | head -n-1)
     
-    if [ "$HTTP_CODE" -eq 200 ] && echo "$BODY" | grep -q "click_count"; then
+    if [ -z "$API_KEY" ]; then
+        if [ "$HTTP_CODE" -eq 401 ]; then
+            print_result 0 "Reject anonymous analytics request"
+        else
+            print_result 1 "Reject anonymous analytics request (expected 401, got $HTTP_CODE)"
+        fi
+    elif [ "$HTTP_CODE" -eq 200 ] && echo "$BODY" | grep -q "click_count"; then
         CLICK_COUNT=$(echo "$BODY" | grep -o '"click_count":[0-9]*' | cut -d':' -f2)
         print_result 0 "Get analytics (clicks: $CLICK_COUNT)"
     else
@@ -155,11 +168,11 @@ echo ""
 echo "Test 9: Handle Non-existent Short Code"
 HTTP_CODE=$(curl -s -o /dev/null -w "%{http_code}" "$BASE_URL/nonexistent123")
 
-# Handler redirects to /not-found with 303 (See Other)
-if [ "$HTTP_CODE" -eq 303 ]; then
+# Unknown codes answer 404 (expired ones would answer 410)
+if [ "$HTTP_CODE" -eq 404 ]; then
     print_result 0 "Handle non-existent short code"
 else
-    print_result 1 "Handle non-existent short code (expected 303, got $HTTP_CODE)"
+    print_result 1 "Handle non-existent short code (expected 404, got $HTTP_CODE)"
 fi
 echo ""
 